@@ -2,31 +2,179 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/user"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
+	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"gopkg.in/yaml.v3"
 )
 
 // --- CONFIGURATION ---
 
-// Config holds application configuration loaded from a JSON file.
+// Config holds application configuration loaded from a JSON or YAML file.
 type Config struct {
-	ApiBaseURL string `json:"apiBaseURL"`
-	ApiToken   string `json:"apiToken"` // Added field for the Bearer token
+	ApiBaseURL            string               `json:"apiBaseURL" yaml:"apiBaseURL" doc:"Base URL of the inventory API, e.g. https://inventory.example.com/api"`
+	ApiToken              string               `json:"apiToken" yaml:"apiToken" doc:"Bearer token sent with every request"`
+	Environments          map[string]EnvConfig `json:"environments" yaml:"environments" doc:"Named environments, each with its own apiBaseURL, apiToken and theme (an accent color for the title and borders); switch with 'E'"`
+	DefaultEnv            string               `json:"defaultEnv" yaml:"defaultEnv" doc:"Environment to start in; defaults to the first name alphabetically"`
+	PollIntervalSeconds   int                  `json:"pollIntervalSeconds" yaml:"pollIntervalSeconds" doc:"Seconds between background refreshes; ctrl+t then +/- changes it live"`
+	RememberPollInterval  bool                 `json:"rememberPollInterval" yaml:"rememberPollInterval" doc:"Save poll intervals changed with ctrl+t back to this file"`
+	PollJitterPercent     int                  `json:"pollJitterPercent" yaml:"pollJitterPercent" doc:"Randomize each poll interval by up to ± this percentage (0-100)"`
+	DisplayTimezone       string               `json:"displayTimezone" yaml:"displayTimezone" doc:"Show report timestamps in Local, UTC or an IANA zone; empty shows them as the API sends them"`
+	WebUrlTemplate        string               `json:"webUrlTemplate" yaml:"webUrlTemplate" doc:"Management UI URL opened with 'o'; {name}, {ip}, {location} and {status} are replaced"`
+	ResponseEnvelopeField string               `json:"responseEnvelopeField" yaml:"responseEnvelopeField" doc:"Field holding the server list when the API wraps it in an object; empty for a bare array"`
+	MaxRetries            int                  `json:"maxRetries" yaml:"maxRetries" doc:"Extra attempts for requests that fail to connect (and for reads, on 5xx responses)"`
+	RetryMutations        bool                 `json:"retryMutations" yaml:"retryMutations" doc:"Also retry add/edit/delete requests, only when they failed to connect"`
+	LogFile               string               `json:"logFile" yaml:"logFile" doc:"Append diagnostic logs (e.g. skipped records) to this file; empty disables logging"`
+	SshCommandTemplate    string               `json:"sshCommandTemplate" yaml:"sshCommandTemplate" doc:"Command copied with 'c'; {user}, {name}, {ip}, {location} and {status} are replaced"`
+	SshUser               string               `json:"sshUser" yaml:"sshUser" doc:"Value for {user} in sshCommandTemplate; defaults to the local user name"`
+
+	path                  string   // the file this config was loaded from
+	PingPort              int      `json:"pingPort" yaml:"pingPort" doc:"TCP port dialed by the 'P' reachability sweep"`
+	InventoryPath         string   `json:"inventoryPath" yaml:"inventoryPath" doc:"API path for listing, fetching and creating servers"`
+	ReportPath            string   `json:"reportPath" yaml:"reportPath" doc:"API path for updating a server"`
+	SummaryEndpoint       string   `json:"summaryEndpoint" yaml:"summaryEndpoint" doc:"Optional API path, e.g. /summary, returning authoritative status counts as a JSON object of status to count"`
+	DeletePath            string   `json:"deletePath" yaml:"deletePath" doc:"API path prefix for deleting a server; the name is appended"`
+	CABundlePath          string   `json:"caBundlePath" yaml:"caBundlePath" doc:"PEM file of CA certificates trusted for the API, in addition to the system ones"`
+	ClientCertPath        string   `json:"clientCertPath" yaml:"clientCertPath" doc:"PEM client certificate for mutual TLS; requires clientKeyPath"`
+	ClientKeyPath         string   `json:"clientKeyPath" yaml:"clientKeyPath" doc:"PEM private key matching clientCertPath"`
+	ColumnWidths          []int    `json:"columnWidths" yaml:"columnWidths" doc:"Widths of the Name, IP, Location, Status and Last Report columns ('W' adjusts them live)"`
+	StaleThresholdMinutes int      `json:"staleThresholdMinutes" yaml:"staleThresholdMinutes" doc:"Reports older than this many minutes count as stale for the 'T' filter"`
+	ProductionPattern     string   `json:"productionPattern" yaml:"productionPattern" doc:"Regex matched against server and environment names; matching deletions must be confirmed by typing the name"`
+	SlackWebhookURL       string   `json:"slackWebhookURL" yaml:"slackWebhookURL" doc:"If set, deletions made with the tool are announced to this Slack incoming webhook"`
+	Pinned                []string `json:"pinned" yaml:"pinned" doc:"Names of pinned servers; maintained by the '*' key"`
+	HistoryFile           string   `json:"historyFile" yaml:"historyFile" doc:"If set, observed inventory changes are appended to this file ('h' shows them)"`
+	AltRowColor           string   `json:"altRowColor" yaml:"altRowColor" doc:"Background of every other table row, as an ANSI color number or #hex; empty disables the shading"`
+	ColorWholeRow         bool     `json:"colorWholeRow" yaml:"colorWholeRow" doc:"Tint the whole row of servers that aren't Online, not just the Status cell"`
+	HideFooter            bool     `json:"hideFooter" yaml:"hideFooter" doc:"Start with the key hint footer hidden ('F' toggles it)"`
+	MetricsAddr           string   `json:"metricsAddr" yaml:"metricsAddr" doc:"If set, serve Prometheus metrics on this address, e.g. ':9100'"`
+	BulkDeleteConfirmAt   int      `json:"bulkDeleteConfirmAt" yaml:"bulkDeleteConfirmAt" doc:"Deleting more than this many selected servers at once must be confirmed by typing 'yes'"`
+	MaxServers            int      `json:"maxServers" yaml:"maxServers" doc:"Stop reading the inventory after this many servers, guarding against runaway responses"`
+	SoftDeleteSupported   bool     `json:"softDeleteSupported" yaml:"softDeleteSupported" doc:"Offer to decommission a server (PATCH its status) instead of deleting it"`
+	DecommissionStatus    string   `json:"decommissionStatus" yaml:"decommissionStatus" doc:"Status set when a server is decommissioned"`
+	CurlShowToken         bool     `json:"curlShowToken" yaml:"curlShowToken" doc:"Put the real API token in curl commands copied with 'U'; otherwise $WOLF_INV_TOKEN stands in for it"`
+	EmptyMessage          string   `json:"emptyMessage" yaml:"emptyMessage" doc:"Shown instead of the table when the inventory is empty"`
+	MaxConcurrency        int      `json:"maxConcurrency" yaml:"maxConcurrency" doc:"Most add/edit/delete requests a bulk action or import sends at once"`
+	UserAgent             string   `json:"userAgent" yaml:"userAgent" doc:"User-Agent sent to the API; defaults to wolf-inv/<version> (<os>)"`
+	TokenFile             string   `json:"tokenFile" yaml:"tokenFile" doc:"If set, the Bearer token is read from this file before every request instead of using apiToken, so an external agent can rotate it"`
+}
+
+// defaultConfig returns the configuration values used for fields missing from the file.
+func defaultConfig() Config {
+	return Config{
+		PollIntervalSeconds:   30,
+		PollJitterPercent:     10,
+		MaxRetries:            2,
+		SshCommandTemplate:    "ssh {user}@{ip}",
+		PingPort:              22,
+		StaleThresholdMinutes: 60,
+		BulkDeleteConfirmAt:   5,
+		MaxServers:            10000,
+		DecommissionStatus:    "Decommissioned",
+		MaxConcurrency:        4,
+		AltRowColor:           "236",
+		EmptyMessage:          "No servers in inventory. Press 'a' to add one.",
+		InventoryPath:         "/inventory",
+		ReportPath:            "/report",
+		DeletePath:            "/delete",
+	}
+}
+
+// EnvConfig holds the connection settings for one named environment.
+type EnvConfig struct {
+	ApiBaseURL string `json:"apiBaseURL" yaml:"apiBaseURL"`
+	ApiToken   string `json:"apiToken" yaml:"apiToken"`
+	Theme      string `json:"theme" yaml:"theme"` // accent color, e.g. "9" to make production stand out
+}
+
+// printExampleConfig writes the default configuration as JSON to w, ready to
+// be redirected into a config file, and describes each field on docs. The
+// descriptions come from the doc tags on Config so they stay in sync with it.
+func printExampleConfig(w, docs io.Writer) error {
+	config := defaultConfig()
+	config.Environments = map[string]EnvConfig{}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(data))
+
+	t := reflect.TypeOf(config)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fmt.Fprintf(docs, "%-22s %s\n", field.Tag.Get("json"), field.Tag.Get("doc"))
+	}
+	return nil
+}
+
+// envNames returns the configured environment names in sorted order.
+func (c *Config) envNames() []string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-// loadConfig reads the configuration from a standard location (~/.config/wolf-inv/config.json).
+// activeEnv returns the environment to start in. Without any named
+// environments the top-level apiBaseURL/apiToken are used and the name is empty.
+func (c *Config) activeEnv() (string, EnvConfig, error) {
+	if len(c.Environments) == 0 {
+		return "", EnvConfig{ApiBaseURL: c.ApiBaseURL, ApiToken: c.ApiToken}, nil
+	}
+	name := c.DefaultEnv
+	if name == "" {
+		name = c.envNames()[0]
+	}
+	env, ok := c.Environments[name]
+	if !ok {
+		return "", EnvConfig{}, fmt.Errorf("defaultEnv %q is not defined in environments", name)
+	}
+	return name, env, nil
+}
+
+// loadConfig reads the configuration from a standard location (~/.config/wolf-inv/config.json),
+// falling back to config.yaml or config.yml in the same directory.
 func loadConfig() (*Config, error) {
 	// Get the user's home directory to find the config folder.
 	homeDir, err := os.UserHomeDir()
@@ -45,8 +193,42 @@ func loadConfig() (*Config, error) {
 		}
 	}
 
-	// Open the config file from the standard path.
-	file, err := os.Open(configPath)
+	// Fall back to a YAML config when there is no config.json.
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		for _, name := range []string{"config.yaml", "config.yml"} {
+			if _, err := os.Stat(filepath.Join(configDir, name)); err == nil {
+				configPath = filepath.Join(configDir, name)
+				break
+			}
+		}
+	}
+
+	return loadConfigFile(configPath)
+}
+
+// loadConfigFile reads and validates the config at configPath, parsing it as
+// YAML for .yaml/.yml files and as JSON otherwise.
+// statConfig and openConfig are how loadConfigFile reaches the file; tests
+// swap them to produce errors that root would never see.
+var (
+	statConfig = os.Stat
+	openConfig = os.Open
+)
+
+func loadConfigFile(configPath string) (*Config, error) {
+	info, err := statConfig(configPath)
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return nil, fmt.Errorf("permission denied reading %s", configPath)
+	case err == nil && info.IsDir():
+		return nil, fmt.Errorf("config path %s is a directory, not a file", configPath)
+	case err == nil && !info.Mode().IsRegular():
+		return nil, fmt.Errorf("config path %s is not a regular file", configPath)
+	}
+	file, err := openConfig(configPath)
+	if errors.Is(err, fs.ErrPermission) {
+		return nil, fmt.Errorf("permission denied reading %s", configPath)
+	}
 	if err != nil {
 		// Provide a helpful error message guiding the user.
 		return nil, fmt.Errorf("could not open config file. Please create one at '%s': %w", configPath, err)
@@ -58,14 +240,226 @@ func loadConfig() (*Config, error) {
 		return nil, fmt.Errorf("could not read config file: %w", err)
 	}
 
-	var config Config
-	if err := json.Unmarshal(bytes, &config); err != nil {
-		return nil, fmt.Errorf("could not parse config.json: %w", err)
+	// Unknown fields are rejected so that typos surface here instead of as
+	// mysterious auth or connection failures later.
+	config := defaultConfig()
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(bytes)))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&config)
+		if err == io.EOF {
+			err = nil
+		}
+	default:
+		decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&config)
+		if err == nil {
+			// encoding/json matches names case-insensitively, so "apitoken"
+			// would quietly set apiToken; only exact names are accepted.
+			if err := checkJSONKeys(bytes, reflect.TypeOf(config)); err != nil {
+				return nil, fmt.Errorf("%v in %s; check its spelling against -print-config", err, filepath.Base(configPath))
+			}
+		}
+		if field, ok := strings.CutPrefix(fmt.Sprint(err), "json: unknown field "); ok {
+			return nil, fmt.Errorf("unknown field %s in %s; check its spelling against -print-config", field, filepath.Base(configPath))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", filepath.Base(configPath), err)
+	}
+	if config.PollJitterPercent < 0 || config.PollJitterPercent > 100 {
+		return nil, fmt.Errorf("pollJitterPercent must be between 0 and 100, got %d", config.PollJitterPercent)
+	}
+	for name, path := range map[string]string{"inventoryPath": config.InventoryPath, "reportPath": config.ReportPath, "deletePath": config.DeletePath} {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("%s must start with '/', got %q", name, path)
+		}
+	}
+	if config.SummaryEndpoint != "" && !strings.HasPrefix(config.SummaryEndpoint, "/") {
+		return nil, fmt.Errorf("summaryEndpoint must start with '/', got %q", config.SummaryEndpoint)
+	}
+	if config.PingPort < 1 || config.PingPort > 65535 {
+		return nil, fmt.Errorf("pingPort must be between 1 and 65535, got %d", config.PingPort)
+	}
+	if _, err := regexp.Compile(config.ProductionPattern); err != nil {
+		return nil, fmt.Errorf("invalid productionPattern: %w", err)
+	}
+	if config.ColumnWidths != nil {
+		if len(config.ColumnWidths) != len(columnTitles) {
+			return nil, fmt.Errorf("columnWidths needs %d values, got %d", len(columnTitles), len(config.ColumnWidths))
+		}
+		for i, width := range config.ColumnWidths {
+			if width < minColumnWidth || width > maxColumnWidth {
+				return nil, fmt.Errorf("columnWidths: %s width must be between %d and %d, got %d", columnTitles[i], minColumnWidth, maxColumnWidth, width)
+			}
+		}
+	}
+	if config.StaleThresholdMinutes < 1 {
+		return nil, fmt.Errorf("staleThresholdMinutes must be at least 1, got %d", config.StaleThresholdMinutes)
+	}
+	if config.MaxServers < 1 {
+		return nil, fmt.Errorf("maxServers must be at least 1, got %d", config.MaxServers)
+	}
+	if interval := time.Duration(config.PollIntervalSeconds) * time.Second; interval < minPollInterval || interval > maxPollInterval {
+		return nil, fmt.Errorf("pollIntervalSeconds must be between %d and %d, got %d", int(minPollInterval.Seconds()), int(maxPollInterval.Seconds()), config.PollIntervalSeconds)
+	}
+	if config.MaxConcurrency < 1 {
+		return nil, fmt.Errorf("maxConcurrency must be at least 1, got %d", config.MaxConcurrency)
+	}
+	if config.BulkDeleteConfirmAt < 0 {
+		return nil, fmt.Errorf("bulkDeleteConfirmAt must not be negative, got %d", config.BulkDeleteConfirmAt)
+	}
+	if config.MaxRetries < 0 {
+		return nil, fmt.Errorf("maxRetries must not be negative, got %d", config.MaxRetries)
+	}
+	if config.DisplayTimezone != "" {
+		if _, err := time.LoadLocation(config.DisplayTimezone); err != nil {
+			return nil, fmt.Errorf("invalid displayTimezone %q: %w", config.DisplayTimezone, err)
+		}
 	}
 
+	config.path = configPath
 	return &config, nil
 }
 
+// checkJSONKeys reports the first key in data, at any depth, that is not
+// spelled exactly as a json tag of typ.
+func checkJSONKeys(data []byte, typ reflect.Type) error {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal(data, &object) != nil {
+		return nil // not an object; the decoder has already checked its type
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		for key, value := range object {
+			field, ok := jsonField(typ, key)
+			if !ok {
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				return fmt.Errorf("unknown field %q (did you mean %q?)", key, name)
+			}
+			if err := checkJSONKeys(value, field.Type); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, value := range object {
+			if err := checkJSONKeys(value, typ.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonField finds the field of typ whose json name is key. When there is
+// none, it returns the field that only differs in case with ok false.
+func jsonField(typ reflect.Type, key string) (field reflect.StructField, ok bool) {
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == key {
+			return typ.Field(i), true
+		}
+		if strings.EqualFold(name, key) {
+			field = typ.Field(i)
+		}
+	}
+	return field, false
+}
+
+// setConfigValue sets one top-level key in the config file at path and keeps
+// the other settings. The file is re-encoded: YAML keeps its comments and key
+// order but is re-indented, and JSON keys come back sorted. It is replaced in
+// one rename, so a crash never leaves it half written.
+func setConfigValue(path, key string, value any) error {
+	// Replace the file a symlinked config points to, not the link.
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if len(doc.Content) == 0 {
+			doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+		}
+		root := doc.Content[0]
+		var valueNode yaml.Node
+		if err := valueNode.Encode(value); err != nil {
+			return err
+		}
+		found := false
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == key {
+				root.Content[i+1] = &valueNode
+				found = true
+			}
+		}
+		if !found {
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &valueNode)
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return err
+		}
+		out = buf.Bytes()
+	default:
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fields[key] = encoded
+		if out, err = json.MarshalIndent(fields, "", "  "); err != nil {
+			return err
+		}
+		out = append(out, '\n')
+	}
+	return writeFileAtomic(path, out, info.Mode().Perm())
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so readers see either the old contents or the new.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 // --- MODEL ---
 
 // Server represents a single server entry from the API.
@@ -75,6 +469,51 @@ type Server struct {
 	Location   string `json:"location"`
 	Status     string `json:"status"`
 	LastReport string `json:"last_report"`
+	// Services lists what runs on the host, usually as name:port, e.g. "https:443".
+	Services []string `json:"services,omitempty"`
+	// Tags are free-form labels. Backends send them as an array or as a single
+	// comma-joined string; both decode to the same list.
+	Tags tagList `json:"tags,omitempty"`
+	// Audit fields are read-only and only filled in by backends that track them.
+	ModifiedBy string `json:"modified_by,omitempty"`
+	ModifiedAt string `json:"modified_at,omitempty"`
+	// MaintenanceUntil is when a Maintenance window is due to end, if the
+	// backend schedules them. Read-only, like the audit fields.
+	MaintenanceUntil string `json:"maintenance_until,omitempty"`
+}
+
+// tagList is a list of tags that also decodes from a comma-joined string,
+// e.g. "web, eu" as well as ["web","eu"]. Blank entries are dropped.
+type tagList []string
+
+func (t *tagList) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var tags []string
+	switch value := raw.(type) {
+	case nil:
+	case string:
+		tags = strings.Split(value, ",")
+	case []any:
+		for _, item := range value {
+			tag, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("tags: expected strings, got %s", data)
+			}
+			tags = append(tags, tag)
+		}
+	default:
+		return fmt.Errorf("tags: expected an array or a comma-separated string, got %s", data)
+	}
+	*t = nil
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			*t = append(*t, tag)
+		}
+	}
+	return nil
 }
 
 // State represents the current mode of the TUI application.
@@ -86,6 +525,21 @@ const (
 	Editing
 	Deleting
 	Help // New state for the help view
+	SwitchingEnv
+	Detail
+	RawResponse
+	AddAnother    // offered after a successful add
+	Importing     // asking for a CSV file to import
+	PingAll       // reachability sweep results
+	History       // observed inventory changes across sessions
+	BulkStatus    // picking the status for all selected servers
+	BulkConfirm   // confirming a bulk status change
+	ImportConfirm // reviewing new vs. existing servers before importing
+	Touching      // confirming a heartbeat re-send for touchTarget
+	Picking       // fullscreen fuzzy picker of server names
+	DeleteChoice  // choosing between decommissioning and deleting
+	Annotating    // typing a local note for annotateTarget
+	Comparing     // side-by-side diff of compareBase against another server
 )
 
 // AddingState represents the sub-state when adding/editing a server.
@@ -95,27 +549,48 @@ const (
 	InputName AddingState = iota
 	InputIP
 	InputLocation
+	InputServices
 	InputStatus
 	Confirm
 )
 
+// statuses are the server statuses offered in forms and the status filter bar, in display order.
+var statuses = []string{"Online", "Offline", "Maintenance"}
+
 // statusItem is a simple item for the list.
 type statusItem string
 
 func (i statusItem) FilterValue() string { return string(i) }
 
-// itemDelegate is the list delegate for rendering status options.
+// envItem is an environment name in the environment switcher list.
+type envItem string
+
+func (i envItem) FilterValue() string { return string(i) }
+
+// serverItem is a server name in the fullscreen server picker.
+type serverItem string
+
+func (i serverItem) FilterValue() string { return string(i) }
+
+// deleteOption is an entry in the decommission-or-delete choice.
+type deleteOption string
+
+func (i deleteOption) FilterValue() string { return string(i) }
+
+// The delete choice options, in display order.
+const (
+	optionDecommission deleteOption = "Decommission"
+	optionHardDelete   deleteOption = "Permanently delete"
+)
+
+// itemDelegate is the list delegate for rendering status and environment options.
 type itemDelegate struct{}
 
-func (d itemDelegate) Height() int                                                 { return 1 }
-func (d itemDelegate) Spacing() int                                                { return 0 }
-func (d itemDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd                   { return nil }
+func (d itemDelegate) Height() int                               { return 1 }
+func (d itemDelegate) Spacing() int                              { return 0 }
+func (d itemDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd { return nil }
 func (d itemDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
-	s, ok := item.(statusItem)
-	if !ok {
-		return
-	}
-	str := fmt.Sprintf("%s", s)
+	str := item.FilterValue()
 	if index == m.Index() {
 		fmt.Fprintf(w, "> %s", lipgloss.NewStyle().Foreground(lipgloss.Color("#5696E3")).Render(str))
 	} else {
@@ -123,21 +598,116 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, item list.Ite
 	}
 }
 
+// pendingEdit remembers the row an optimistic add or edit replaced, so it
+// can be rolled back if the API rejects the change.
+type pendingEdit struct {
+	server   Server // the submitted version shown in the table
+	previous Server
+	existed  bool // false for adds, which are rolled back by removing the row
+}
+
+// pendingDelete remembers an optimistically removed row so it can be restored.
+type pendingDelete struct {
+	server Server
+	index  int // position in m.servers before removal
+}
+
 // Model represents the state of our TUI application.
 type model struct {
-	servers       []Server
-	err           error
-	loading       bool
-	message       string
-	state         State
-	addingState   AddingState
-	table         table.Model
-	textInput     textinput.Model
-	statusList    list.Model
-	currentServer Server
-	deleteTarget  string
-	apiBaseURL    string
-	apiToken      string // Added field to store the API token
+	servers         []Server
+	err             error
+	loading         bool
+	message         string
+	state           State
+	addingState     AddingState
+	table           table.Model
+	textInput       textinput.Model
+	statusList      list.Model
+	currentServer   Server
+	originalServer  Server // the server as it was before editing began
+	staleConfirmed  bool   // the stale-report warning was acknowledged with a first y
+	ipValid         bool   // whether the IP being typed currently parses
+	lastAction      State  // Adding, Editing or Deleting once something was submitted, else Viewing
+	lastServer      Server // what the last action submitted (only Name for deletes)
+	lastCreated     Server // the server just created, offered as a template by "Add another?"
+	deleteTarget    string
+	deleteBatch     []Server // the selected servers a bulk delete removes; nil for single deletes
+	softDelete      bool     // the confirmed delete decommissions deleteTarget instead
+	deleteOptions   list.Model
+	touchTarget     Server          // the server a confirmed touch re-reports unchanged
+	selected        map[string]bool // names picked with space for bulk actions
+	bulkStatus      string          // status chosen for a bulk change
+	bulkProgress    <-chan bulkProgressMsg
+	strictDelete    bool           // deleteTarget must be typed out to confirm
+	productionRe    *regexp.Regexp // names matching it get strictDelete; nil disables
+	apiBaseURL      string
+	apiToken        string       // Added field to store the API token
+	api             APIClient    // backend used by all commands, built from apiBaseURL/apiToken
+	httpClient      *http.Client // shared by the API clients of every environment
+	config          *Config      // configuration loaded at startup
+	visible         []Server     // servers in the order they are shown in the table
+	sortColumn      int          // index into columnTitles, or -1 for API order
+	sortAsc         bool
+	prioritySort    bool                     // group servers that are not Online above the rest
+	iconMode        bool                     // show statuses as narrow icons instead of text
+	showSummary     bool                     // show the per-location panel beside the table
+	compact         bool                     // one line per server instead of the bordered table
+	shortIPv6       bool                     // abbreviate IPv6 addresses in the table to their last two groups
+	showFooter      bool                     // show the key hint line under the table
+	wrapMessage     bool                     // wrap a long message line to the window width instead of cutting it off
+	height          int                      // terminal height, 0 until the first WindowSizeMsg
+	width           int                      // terminal width, 0 until the first WindowSizeMsg
+	rawResponse     []byte                   // body of the last /inventory response
+	summaryCounts   map[string]int           // status counts from summaryEndpoint, nil to count m.servers
+	rawView         viewport.Model           // scrollable view of rawResponse
+	historyView     viewport.Model           // scrollable list of recorded inventory changes
+	pendingDeletes  map[string]pendingDelete // rows removed ahead of the API confirming the delete
+	pendingEdits    map[string]pendingEdit   // rows added or edited ahead of the API confirming
+	importPlan      importPlan               // the import awaiting confirmation
+	ping            pingSweep                // the current or last reachability sweep
+	deferred        []tea.Msg                // background results held while a form or overlay is open
+	metrics         *fetchMetrics            // where inventory fetches are recorded; nil records nothing
+	notify          func(tea.Msg)            // sends a message into the running program, e.g. retry progress; nil when there is none
+	environments    map[string]EnvConfig
+	envName         string // active environment, empty when none are configured
+	envList         list.Model
+	picker          list.Model           // fullscreen server picker opened with ctrl+p
+	pollJitter      int                  // percentage applied to each poll interval
+	pollInterval    time.Duration        // base delay between background refreshes
+	pollGen         int                  // bumped when the interval changes so the old schedule stops
+	adjustingPoll   bool                 // whether +/- change the poll interval (ctrl+t)
+	changedAt       map[string]time.Time // when each server's status last changed
+	flashRow        string               // server briefly highlighted after a single-row refresh
+	displayLoc      *time.Location       // zone for report timestamps, nil to show them raw
+	webURLTemplate  string
+	loadedOnce      bool        // whether any fetch has succeeded yet
+	retry           retryingMsg // the latest retry reported while loading; zero when none
+	fetchFailed     bool        // whether the latest inventory fetch failed
+	startupAttempts int         // automatic retries made before the first successful load
+	filterInput     textinput.Model
+	filterQuery     string            // active filter, applied in updateTable
+	filter          filterExpr        // the last query that parsed, used while filterQuery is invalid
+	filterErr       string            // why filterQuery failed to parse; empty when it parsed
+	filtering       bool              // whether the filter input has focus
+	columnFilters   []textinput.Model // per-column filters, in column order, ANDed together
+	columnFiltering bool              // whether the per-column filter row has focus
+	columnFocus     int               // the column filter being typed into
+	staleOnly       bool              // show only servers whose last report is older than the stale threshold
+	locationOnly    string            // show only servers in this location, set with 'l'
+	pinned          map[string]bool   // pinned server names, persisted to the config
+	marks           map[string]string // vim-style marks: mark key to server name
+	annotations     map[string]string // local notes keyed by server name, never sent to the API
+	annotateTarget  string            // the server a note is being written for
+	compareBase     string            // server marked with '=' to diff others against
+	comparePair     [2]Server         // the base and the server being compared, captured when the diff opened
+	markPending     string            // "m" or "'" while waiting for the mark key
+	pinView         pinView
+	resizing        bool            // adjusting column widths with +/-
+	resizeColumn    int             // the column +/- apply to
+	columnWidths    []int           // overrides columnWidths when set
+	tableOffset     int             // first row of m.visible drawn in the table, kept around the cursor by fitTable
+	statusWidth     int             // widest Status cell in view, so maintenance badges aren't cut off
+	statusFilter    map[string]bool // statuses shown in the table, toggled with the number keys
 	// Styles
 	spinnerStyle    lipgloss.Style
 	headerStyle     lipgloss.Style
@@ -150,13 +720,140 @@ type model struct {
 	cancelStyle     lipgloss.Style
 	helpStyle       lipgloss.Style
 	currentMsgStyle lipgloss.Style
+	changedStyle    lipgloss.Style
+	flashStyle      lipgloss.Style
+	annotationStyle lipgloss.Style
 	messageTimer    *time.Timer
 }
 
 // Init runs any initial commands for the app.
 func (m model) Init() tea.Cmd {
 	// Pass the API token to the initial fetch command
-	return tea.Batch(fetchServers(m.apiBaseURL, m.apiToken), pollForUpdates(30*time.Second))
+	return tea.Batch(fetchServers(m.api, m.metrics), m.schedulePoll())
+}
+
+// applyConfig sets everything the model derives from the configuration,
+// connecting to env as the environment named envName.
+func (m *model) applyConfig(config *Config, httpClient *http.Client, envName string, env EnvConfig) {
+	m.config = config
+	m.httpClient = httpClient
+	m.environments = config.Environments
+	m.envName = envName
+	m.apiBaseURL = env.ApiBaseURL
+	m.apiToken = env.ApiToken
+	m.api = newTUIClient(env.ApiBaseURL, env.ApiToken, httpClient, config, m.notify)
+	m.applyTheme(env.Theme)
+	envItems := []list.Item{}
+	for _, name := range config.envNames() {
+		envItems = append(envItems, envItem(name))
+	}
+	m.envList.SetItems(envItems)
+	m.pollJitter = config.PollJitterPercent
+	m.summaryCounts = nil
+	m.pollInterval = time.Duration(config.PollIntervalSeconds) * time.Second
+	m.webURLTemplate = config.WebUrlTemplate
+	m.displayLoc = nil
+	if config.DisplayTimezone != "" {
+		m.displayLoc, _ = time.LoadLocation(config.DisplayTimezone) // validated by loadConfig
+	}
+	m.productionRe = nil
+	if config.ProductionPattern != "" {
+		m.productionRe = regexp.MustCompile(config.ProductionPattern) // validated by loadConfig
+	}
+	m.pinned = map[string]bool{}
+	for _, name := range config.Pinned {
+		m.pinned[name] = true
+	}
+	if config.ColumnWidths != nil {
+		m.columnWidths = append([]int(nil), config.ColumnWidths...)
+	}
+}
+
+// applyTheme colors the title and borders with an environment's accent color,
+// an ANSI color number or #hex. Empty restores the default colors.
+func (m *model) applyTheme(theme string) {
+	title, border := lipgloss.Color("3"), lipgloss.Color("6")
+	if theme != "" {
+		title, border = lipgloss.Color(theme), lipgloss.Color(theme)
+	}
+	m.headerStyle = m.headerStyle.Foreground(title)
+	m.tableStyle = m.tableStyle.BorderForeground(border)
+	m.helpStyle = m.helpStyle.BorderForeground(border)
+}
+
+// newModel builds the TUI state for config, connected to env as the
+// environment named envName. notify is how background work such as request
+// retries reports into the running program.
+func newModel(config *Config, httpClient *http.Client, envName string, env EnvConfig, notify func(tea.Msg)) model {
+	items := []list.Item{}
+	statusFilter := map[string]bool{}
+	for _, status := range statuses {
+		items = append(items, statusItem(status))
+		statusFilter[status] = true
+	}
+	// Initialize styles
+	messageStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("7")).Italic(true)
+
+	m := model{
+		notify:          notify,
+		envList:         list.New(nil, itemDelegate{}, 40, 12),
+		picker:          list.New(nil, itemDelegate{}, 0, 0),
+		deleteOptions:   list.New([]list.Item{optionDecommission, optionHardDelete}, itemDelegate{}, 40, 6),
+		loading:         true,
+		message:         "Initializing...",
+		state:           Viewing,
+		table:           table.New(),
+		textInput:       textinput.New(),
+		filterInput:     textinput.New(),
+		rawView:         viewport.New(0, 0),
+		historyView:     viewport.New(0, 0),
+		statusFilter:    statusFilter,
+		statusList:      list.New(items, itemDelegate{}, 0, 0),
+		spinnerStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("12")),
+		headerStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true).MarginBottom(1),
+		onlineStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("10")),
+		offlineStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("9")),
+		otherStyle:      lipgloss.NewStyle().Foreground(lipgloss.Color("11")),
+		tableStyle:      lipgloss.NewStyle().Border(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("6")).Padding(1),
+		messageStyle:    messageStyle,
+		successStyle:    messageStyle.Copy().Foreground(lipgloss.Color("10")), // Green
+		cancelStyle:     messageStyle.Copy().Foreground(lipgloss.Color("11")), // Yellow
+		helpStyle:       lipgloss.NewStyle().Padding(1, 2).Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("6")),
+		currentMsgStyle: messageStyle,
+		sortColumn:      -1,
+		showFooter:      !config.HideFooter,
+		changedAt:       map[string]time.Time{},
+		pendingDeletes:  map[string]pendingDelete{},
+		pendingEdits:    map[string]pendingEdit{},
+		selected:        map[string]bool{},
+		marks:           map[string]string{},
+		changedStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("13")).Blink(true),
+		flashStyle:      lipgloss.NewStyle().Foreground(lipgloss.Color("0")).Background(lipgloss.Color("12")),
+		annotationStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("0")).Background(lipgloss.Color("214")),
+		annotations:     loadAnnotations(annotationsPath(config)),
+	}
+	m.applyConfig(config, httpClient, envName, env)
+	m.statusList.Title = "Select Server Status"
+	m.envList.Title = "Select Environment"
+	m.envList.SetFilteringEnabled(false)
+	m.picker.Title = "Jump to Server"
+	m.deleteOptions.Title = "Decommission or delete?"
+	m.deleteOptions.SetFilteringEnabled(false)
+	m.deleteOptions.SetShowStatusBar(false)
+	m.deleteOptions.SetShowHelp(false)
+	m.deleteOptions.KeyMap.Quit.SetEnabled(false)
+	// Esc and q belong to the picker's own cancel and filter input.
+	m.picker.KeyMap.Quit.SetEnabled(false)
+	m.filterInput.Prompt = ""
+	m.filterInput.Placeholder = "name, ip:, loc:, status:, AND/OR, *"
+	m.columnFilters = make([]textinput.Model, len(columnTitles))
+	for i := range m.columnFilters {
+		m.columnFilters[i] = textinput.New()
+		m.columnFilters[i].Prompt = ""
+	}
+	m.updateTable()
+	m.table.Focus()
+	return m
 }
 
 // --- UPDATE ---
@@ -165,10 +862,26 @@ func (m model) Init() tea.Cmd {
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
+	// Retries are reported from whichever request is running; only the
+	// loading indicator shows them, so they apply in any state.
+	if retry, ok := msg.(retryingMsg); ok {
+		if m.loading {
+			m.retry = retry
+		}
+		return m, nil
+	}
+
 	// Global handling for window size changes
 	if size, ok := msg.(tea.WindowSizeMsg); ok {
 		m.table, cmd = m.table.Update(size)
 		m.statusList, _ = m.statusList.Update(size)
+		m.picker.SetSize(size.Width, size.Height)
+		// Leave room for the header and the footer hint.
+		m.rawView.Width = size.Width
+		m.rawView.Height = max(1, size.Height-6)
+		m.historyView.Width, m.historyView.Height = m.rawView.Width, m.rawView.Height
+		m.height, m.width = size.Height, size.Width
+		m.fitTable()
 		return m, cmd
 	}
 
@@ -179,103 +892,1031 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if m.state != Viewing {
+		// Keep polling, but hold background results until the user is back
+		// in the table so nothing is rebuilt under an open form.
+		if poll, ok := msg.(fetchServersMsg); ok {
+			return m, m.poll(poll)
+		}
+		if m.deferrable(msg) {
+			m.deferred = append(m.deferred, msg)
+			return m, nil
+		}
+	}
+
+	next, cmd := m.dispatch(msg)
+	if next.state == Viewing && len(next.deferred) > 0 {
+		var replayed tea.Cmd
+		next, replayed = next.replayDeferred()
+		cmd = tea.Batch(cmd, replayed)
+	}
+	next.fitTable()
+	return next, cmd
+}
+
+// deferrable reports whether msg should wait for the table rather than go to
+// the open form or overlay. Every message this program defines is the result
+// of background work and waits, except the few a state consumes itself. Keys,
+// mouse events and the components' own ticks (cursor blink, list filtering)
+// come from other packages and always go through.
+func (m model) deferrable(msg tea.Msg) bool {
+	switch msg.(type) {
+	case nil, clearMessage:
+		return false
+	case pingResultMsg, pingDoneMsg:
+		return m.state != PingAll
+	}
+	return reflect.TypeOf(msg).PkgPath() == reflect.TypeOf(m).PkgPath()
+}
+
+// replayDeferred applies background results held while away from the table.
+func (m model) replayDeferred() (model, tea.Cmd) {
+	var cmds []tea.Cmd
+	for len(m.deferred) > 0 && m.state == Viewing {
+		msg := m.deferred[0]
+		m.deferred = m.deferred[1:]
+		next, cmd := updateViewing(msg, m)
+		m = next.(model)
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// dispatch hands msg to the handler for the current state.
+func (m model) dispatch(msg tea.Msg) (model, tea.Cmd) {
+	var next tea.Model
+	var cmd tea.Cmd
 	switch m.state {
 	case Viewing:
-		return updateViewing(msg, m)
+		next, cmd = updateViewing(msg, m)
 	case Adding, Editing:
-		return updateAddingEditing(msg, m)
+		next, cmd = updateAddingEditing(msg, m)
 	case Deleting:
-		return updateDeleting(msg, m)
+		next, cmd = updateDeleting(msg, m)
 	case Help:
-		return updateHelp(msg, m)
+		next, cmd = updateHelp(msg, m)
+	case SwitchingEnv:
+		next, cmd = updateSwitchingEnv(msg, m)
+	case Detail:
+		next, cmd = updateDetail(msg, m)
+	case RawResponse:
+		next, cmd = updateRawResponse(msg, m)
+	case AddAnother:
+		next, cmd = updateAddAnother(msg, m)
+	case Importing:
+		next, cmd = updateImporting(msg, m)
+	case PingAll:
+		next, cmd = updatePingAll(msg, m)
+	case History:
+		next, cmd = updateHistory(msg, m)
+	case BulkStatus, BulkConfirm:
+		next, cmd = updateBulkStatus(msg, m)
+	case ImportConfirm:
+		next, cmd = updateImportConfirm(msg, m)
+	case Touching:
+		next, cmd = updateTouching(msg, m)
+	case Picking:
+		next, cmd = updatePicking(msg, m)
+	case DeleteChoice:
+		next, cmd = updateDeleteChoice(msg, m)
+	case Annotating:
+		next, cmd = updateAnnotating(msg, m)
+	case Comparing:
+		next, cmd = updateDetail(msg, m)
 	}
-
-	return m, cmd
+	if next == nil {
+		return m, cmd
+	}
+	return next.(model), cmd
 }
 
 // updateViewing handles logic for the main table view.
 func updateViewing(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.filtering {
+		return updateFilter(keyMsg, m)
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.resizing {
+		return updateResize(keyMsg, m)
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.markPending != "" {
+		return updateMark(keyMsg, m)
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.adjustingPoll {
+		return updatePollInterval(keyMsg, m)
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.columnFiltering {
+		return updateColumnFilter(keyMsg, m)
+	}
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
+		case "/":
+			m.filtering = true
+			m.table.Blur()
+			m.filterInput.SetValue(m.filterQuery)
+			m.filterInput.CursorEnd()
+			return m, m.filterInput.Focus()
+		case "esc":
+			if m.filterQuery != "" {
+				m.filterQuery = ""
+				m.updateTable()
+				m.setTempMessage(m.cancelStyle, "Filter cleared.")
+			} else if m.locationOnly != "" {
+				m.locationOnly = ""
+				m.updateTable()
+				m.setTempMessage(m.cancelStyle, "Location filter cleared.")
+			} else if m.columnFilterActive() {
+				m.clearColumnFilters()
+				m.updateTable()
+				m.setTempMessage(m.cancelStyle, "Column filters cleared.")
+			} else if len(m.selected) > 0 {
+				m.selected = map[string]bool{}
+				m.setTempMessage(m.cancelStyle, "Selection cleared.")
+			}
+			return m, nil
+		case " ":
+			if server, ok := m.selectedServer(); ok {
+				if m.selected[server.Name] {
+					delete(m.selected, server.Name)
+				} else {
+					m.selected[server.Name] = true
+				}
+				m.table.MoveDown(1)
+			}
+			return m, nil
+		case "B":
+			if len(m.selectedServers()) == 0 {
+				m.setTempMessage(m.cancelStyle, "Select servers with space first.")
+				return m, nil
+			}
+			m.state = BulkStatus
+			m.table.Blur()
+			m.message = fmt.Sprintf("Set the status of %d selected servers:", len(m.selectedServers()))
+			m.currentMsgStyle = m.messageStyle
+			return m, nil
 		case "r":
 			m.loading = true
 			m.message = "Refreshing data..."
 			m.currentMsgStyle = m.messageStyle
-			// Pass the token when refreshing
-			return m, fetchServers(m.apiBaseURL, m.apiToken)
-		case "a":
-			m.state = Adding
+			// Refresh through the API client
+			return m, fetchServers(m.api, m.metrics)
+		case "R":
+			if server, ok := m.selectedServer(); ok {
+				m.loading = true
+				m.message = fmt.Sprintf("Refreshing %s...", server.Name)
+				m.currentMsgStyle = m.messageStyle
+				return m, refreshServer(m.api, m.metrics, server.Name)
+			}
+			return m, nil
+		case "o":
+			server, ok := m.selectedServer()
+			if !ok {
+				return m, nil
+			}
+			if m.webURLTemplate == "" {
+				m.setTempMessage(m.cancelStyle, "No webUrlTemplate configured.")
+				return m, nil
+			}
+			target := expandTemplate(m.webURLTemplate, server)
+			m.setTempMessage(m.successStyle, "Opening "+target)
+			return m, openURL(target)
+		case "enter":
+			if _, ok := m.selectedServer(); ok {
+				m.state = Detail
+				m.table.Blur()
+			}
+			return m, nil
+		case "=":
+			server, ok := m.selectedServer()
+			switch {
+			case !ok:
+			case m.compareBase == server.Name:
+				m.compareBase = ""
+				m.setTempMessage(m.cancelStyle, "Compare base cleared.")
+			default:
+				m.compareBase = server.Name
+				m.setTempMessage(m.successStyle, fmt.Sprintf("Comparing against '%s': select another server and press 'D'.", server.Name))
+			}
+			return m, nil
+		case "D":
+			return m.openCompare()
+		case "1", "2", "3":
+			status := statuses[msg.String()[0]-'1']
+			m.statusFilter[status] = !m.statusFilter[status]
+			m.updateTable()
+			return m, nil
+		case "c":
+			if server, ok := m.selectedServer(); ok {
+				command := strings.ReplaceAll(expandTemplate(m.config.SshCommandTemplate, server), "{user}", m.sshUser())
+				if err := clipboard.WriteAll(command); err != nil {
+					m.setTempMessage(m.cancelStyle, fmt.Sprintf("Could not copy to clipboard: %v", err))
+				} else {
+					m.setTempMessage(m.successStyle, "Copied: "+command)
+				}
+			}
+			return m, nil
+		case "U":
+			if server, ok := m.selectedServer(); ok {
+				command, err := m.curlCommand(server)
+				if err != nil {
+					m.setTempMessage(m.cancelStyle, fmt.Sprintf("Could not build the curl command: %v", err))
+				} else if err := clipboard.WriteAll(command); err != nil {
+					m.setTempMessage(m.cancelStyle, fmt.Sprintf("Could not copy to clipboard: %v", err))
+				} else {
+					m.setTempMessage(m.successStyle, fmt.Sprintf("Copied a curl command that reports '%s'.", server.Name))
+				}
+			}
+			return m, nil
+		case "Y", "ctrl+y":
+			group := ""
+			if msg.String() == "ctrl+y" {
+				group = m.envName
+				if group == "" {
+					group = "servers"
+				}
+			}
+			text, count := ipList(m.visible, group)
+			if count == 0 {
+				m.setTempMessage(m.cancelStyle, "No IPs to copy.")
+				return m, nil
+			}
+			if err := clipboard.WriteAll(text); err != nil {
+				m.setTempMessage(m.cancelStyle, fmt.Sprintf("Could not copy to clipboard: %v", err))
+			} else {
+				m.setTempMessage(m.successStyle, fmt.Sprintf("Copied %d IPs.", count))
+			}
+			return m, nil
+		case "C":
+			// Not y: confirm prompts take y, and a repeated press would land here.
+			if server, ok := m.selectedServer(); ok {
+				if err := clipboard.WriteAll(m.markdownSnippet(server)); err != nil {
+					m.setTempMessage(m.cancelStyle, fmt.Sprintf("Could not copy to clipboard: %v", err))
+				} else {
+					m.setTempMessage(m.successStyle, fmt.Sprintf("Copied '%s' as markdown.", server.Name))
+				}
+			}
+			return m, nil
+		case "x", "X":
+			format := "csv"
+			if msg.String() == "X" {
+				format = "json"
+			}
+			servers, scope := m.exportSet()
+			if len(servers) == 0 {
+				m.setTempMessage(m.cancelStyle, "Nothing to export.")
+				return m, nil
+			}
+			return m, exportServers(servers, scope, format)
+		case "ctrl+f":
+			if len(m.columnFilters) == 0 {
+				return m, nil
+			}
+			m.columnFiltering = true
+			m.table.Blur()
+			return m, m.columnFilters[m.columnFocus].Focus()
+		case "ctrl+s":
+			if len(m.visible) == 0 {
+				m.setTempMessage(m.cancelStyle, "Nothing to snapshot.")
+				return m, nil
+			}
+			return m, saveSnapshot(ansi.Strip(m.tableView()), m.visible)
+		case "I":
+			m.state = Importing
 			m.table.Blur()
-			m.addingState = InputName
-			m.currentServer = Server{}
-			m.textInput.Placeholder = "Name"
-			m.textInput.Focus()
+			m.textInput.Placeholder = "servers.csv"
 			m.textInput.SetValue("")
-			m.message = "Adding new server (Step 1 of 4):"
+			m.message = "Import servers from a CSV file with name, ip, location and status columns:"
 			m.currentMsgStyle = m.messageStyle
-			return m, textinput.Blink
+			return m, m.textInput.Focus()
+		case "a":
+			return m.openForm(Adding, Server{}, Server{})
 		case "d":
-			if len(m.servers) > 0 {
-				selectedRow := m.table.SelectedRow()
-				if len(selectedRow) > 0 {
-					m.deleteTarget = selectedRow[0]
-					m.state = Deleting
-					m.message = ""
+			if len(m.selected) > 0 {
+				return m.chooseBulkDelete()
+			}
+			if server, ok := m.selectedServer(); ok {
+				return m.chooseDelete(server.Name)
+			}
+			return m, nil
+		case "ctrl+p":
+			if len(m.servers) == 0 {
+				return m, nil
+			}
+			items := make([]list.Item, len(m.servers))
+			for i, server := range m.servers {
+				items[i] = serverItem(server.Name)
+			}
+			m.picker.ResetFilter()
+			cmd := m.picker.SetItems(items)
+			// Start in filter mode so typing narrows the list straight away.
+			m.picker.SetFilterState(list.Filtering)
+			m.state = Picking
+			m.table.Blur()
+			return m, cmd
+		case "A":
+			if server, ok := m.selectedServer(); ok {
+				m.annotateTarget = server.Name
+				m.state = Annotating
+				m.table.Blur()
+				m.textInput.Placeholder = "investigating, do not touch"
+				m.textInput.SetValue(m.annotations[server.Name])
+				m.textInput.CursorEnd()
+				m.message = fmt.Sprintf("Note for '%s' (only kept on this machine):", server.Name)
+				m.currentMsgStyle = m.messageStyle
+				return m, m.textInput.Focus()
+			}
+			return m, nil
+		case "ctrl+x":
+			if server, ok := m.selectedServer(); ok && m.annotations[server.Name] != "" {
+				return m.setAnnotation(server.Name, "")
+			}
+			return m, nil
+		case "H":
+			if server, ok := m.selectedServer(); ok {
+				if m.inFlight(server.Name) {
+					m.setTempMessage(m.cancelStyle, fmt.Sprintf("'%s' has a change in flight; try again once it finishes.", server.Name))
+					return m, nil
 				}
+				m.touchTarget = server
+				m.state = Touching
+				m.table.Blur()
+				m.message = ""
 			}
 			return m, nil
 		case "e":
-			if len(m.servers) > 0 {
-				selectedRow := m.table.SelectedRow()
-				if len(selectedRow) > 0 {
-					m.state = Editing
-					m.table.Blur()
-					m.addingState = InputName
-					m.currentServer = Server{
-						Name:       selectedRow[0],
-						IP:         selectedRow[1],
-						Location:   selectedRow[2],
-						Status:     strings.TrimSpace(selectedRow[3]),
-						LastReport: selectedRow[4],
+			if server, ok := m.selectedServer(); ok {
+				return m.openForm(Editing, editableFields(server), editableFields(server))
+			}
+		case ".":
+			// Repeat the last add, edit or delete, pre-filled with what was submitted.
+			switch m.lastAction {
+			case Adding:
+				return m.openForm(Adding, m.lastServer, Server{})
+			case Editing:
+				original := m.lastServer
+				for _, server := range m.servers {
+					if server.Name == m.lastServer.Name {
+						original = editableFields(server)
 					}
-					m.textInput.Placeholder = "Name"
-					m.textInput.Focus()
-					m.textInput.SetValue(m.currentServer.Name)
-					m.message = "Editing server (Step 1 of 4):"
-					m.currentMsgStyle = m.messageStyle
-					return m, textinput.Blink
 				}
+				return m.openForm(Editing, m.lastServer, original)
+			case Deleting:
+				return m.chooseDelete(m.lastServer.Name)
 			}
-		case "?":
-			m.state = Help
 			return m, nil
-		}
-	case serverMsg:
-		m.loading = false
-		m.err = nil
-		m.servers = msg.servers
-		m.updateTable()
-		m.message = fmt.Sprintf("Inventory refreshed at %s", time.Now().Format("15:04:05"))
-		m.setTempMessage(m.successStyle, m.message)
-	case errMsg:
-		m.loading = false
-		m.err = msg
-		m.message = m.err.Error()
+		case "s":
+			// Cycle through the columns, ending back at the API order.
+			m.sortColumn++
+			if m.sortColumn >= len(columnTitles) {
+				m.sortColumn = -1
+			}
+			m.sortAsc = true
+			m.updateTable()
+			return m, nil
+		case "P":
+			if len(m.visible) == 0 {
+				m.setTempMessage(m.cancelStyle, "No servers to ping.")
+				return m, nil
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			m.ping = pingSweep{
+				id:      m.ping.id + 1,
+				servers: append([]Server(nil), m.visible...),
+				results: map[string]pingResult{},
+				cancel:  cancel,
+			}
+			m.ping.ch = startPingSweep(ctx, m.ping.servers, m.config.PingPort)
+			m.state = PingAll
+			m.table.Blur()
+			return m, waitForPing(m.ping.id, m.ping.ch)
+		case "l":
+			// Drill down to the selected server's location; again to go back.
+			if m.locationOnly != "" {
+				m.locationOnly = ""
+			} else if server, ok := m.selectedServer(); ok {
+				m.locationOnly = server.Location
+			}
+			m.updateTable()
+			return m, nil
+		case "Z":
+			// Flip report times between UTC and local time, e.g. to match UTC logs.
+			if m.displayLoc == time.UTC {
+				m.displayLoc = time.Local
+			} else {
+				m.displayLoc = time.UTC
+			}
+			m.updateTable()
+			return m, nil
+		case "z":
+			// Back to the default view: no filters, API order, top of the list.
+			m.filterQuery = ""
+			m.filterInput.SetValue("")
+			m.clearColumnFilters()
+			m.locationOnly = ""
+			m.sortColumn, m.sortAsc = -1, false
+			m.prioritySort = false
+			m.staleOnly = false
+			for status := range m.statusFilter {
+				m.statusFilter[status] = true
+			}
+			if m.pinView == pinsOnly {
+				m.pinView = pinsInline
+			}
+			m.updateTable()
+			m.table.GotoTop()
+			m.setTempMessage(m.successStyle, "View reset.")
+			return m, nil
+		case "t":
+			// Newest reports first; pressing again returns to the API order.
+			if m.recentFirst() {
+				m.sortColumn = -1
+			} else {
+				m.sortColumn, m.sortAsc = lastReportColumn, false
+			}
+			m.updateTable()
+			return m, nil
+		case "ctrl+r":
+			if m.rawResponse == nil {
+				m.setTempMessage(m.cancelStyle, "No API response captured yet.")
+				return m, nil
+			}
+			m.state = RawResponse
+			m.table.Blur()
+			m.rawView.SetContent(prettyJSON(m.rawResponse))
+			m.rawView.GotoTop()
+			return m, nil
+		case "h":
+			if m.config.HistoryFile == "" {
+				m.setTempMessage(m.cancelStyle, "History is off; set historyFile in the config to record it.")
+				return m, nil
+			}
+			return m, loadHistory(m.config.HistoryFile)
+		case "ctrl+t":
+			m.adjustingPoll = true
+			m.message = fmt.Sprintf("Polling every %s: '+' to double, '-' to halve, 'Esc' when done", m.pollInterval)
+			m.currentMsgStyle = m.messageStyle
+			return m, nil
+		case "W":
+			m.resizing = true
+			m.columnWidths = m.widths()
+			m.updateTable()
+			return m, nil
+		case "*":
+			if server, ok := m.selectedServer(); ok {
+				if m.pinned[server.Name] {
+					delete(m.pinned, server.Name)
+				} else {
+					m.pinned[server.Name] = true
+				}
+				m.updateTable()
+				return m, savePinned(m.config.path, m.pinnedNames())
+			}
+			return m, nil
+		case "f":
+			m.pinView = (m.pinView + 1) % 3
+			m.updateTable()
+			if m.pinView == pinsOnly {
+				present := 0
+				for _, server := range m.servers {
+					if m.pinned[server.Name] {
+						present++
+					}
+				}
+				if missing := len(m.pinned) - present; missing > 0 {
+					// Pins outlive servers; say so rather than silently showing fewer rows.
+					m.setTempMessage(m.cancelStyle, fmt.Sprintf("%d pinned servers are no longer in the inventory.", missing))
+				}
+			}
+			return m, nil
+		case "ctrl+l":
+			m.setTempMessage(m.messageStyle, "Reloading config...")
+			return m, reloadConfig(m.envName)
+		case "ctrl+e":
+			if m.config.path == "" {
+				m.setTempMessage(m.cancelStyle, "No config file to edit.")
+				return m, nil
+			}
+			return m, editConfig(m.config.path)
+		case "V":
+			m.compact = !m.compact
+			return m, nil
+		case "m", "'":
+			m.markPending = msg.String()
+			return m, nil
+		case "6":
+			m.shortIPv6 = !m.shortIPv6
+			m.updateTable()
+			return m, nil
+		case "n", "N":
+			step := 1
+			if msg.String() == "N" {
+				step = -1
+			}
+			if i, ok := m.nextUnhealthy(step); ok {
+				m.table.SetCursor(i)
+			} else {
+				m.setTempMessage(m.successStyle, "No offline servers")
+			}
+			return m, nil
+		case "T":
+			m.staleOnly = !m.staleOnly
+			m.updateTable()
+			return m, nil
+		case "F":
+			m.showFooter = !m.showFooter
+			return m, nil
+		case "w":
+			m.wrapMessage = !m.wrapMessage
+			return m, nil
+		case "L":
+			m.showSummary = !m.showSummary
+			return m, nil
+		case "i":
+			m.iconMode = !m.iconMode
+			m.updateTable()
+			return m, nil
+		case "p":
+			m.prioritySort = !m.prioritySort
+			m.updateTable()
+			return m, nil
+		case "S":
+			if m.sortColumn >= 0 {
+				m.sortAsc = !m.sortAsc
+				m.updateTable()
+			}
+			return m, nil
+		case "pgup", "ctrl+u":
+			m.table.MoveUp(m.pageSize())
+			return m, nil
+		case "pgdown", "ctrl+d":
+			m.table.MoveDown(m.pageSize())
+			return m, nil
+		case "M":
+			// Mark every highlighted status change as seen.
+			n := 0
+			for name := range m.changedAt {
+				if m.recentlyChanged(name) {
+					n++
+				}
+			}
+			clear(m.changedAt)
+			m.setTempMessage(m.successStyle, fmt.Sprintf("Cleared %d change markers", n))
+			return m, nil
+		case "E":
+			if len(m.environments) > 0 {
+				m.state = SwitchingEnv
+				m.table.Blur()
+				m.message = "Switch environment:"
+				m.currentMsgStyle = m.messageStyle
+			}
+			return m, nil
+		case "?":
+			m.state = Help
+			return m, nil
+		}
+	case tea.MouseMsg:
+		if !m.compact && msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft && msg.Y == m.tableHeaderY() {
+			if col := m.columnAt(msg.X); col >= 0 {
+				// Clicking the active column flips its direction, any other column becomes the new key.
+				if col == m.sortColumn {
+					m.sortAsc = !m.sortAsc
+				} else {
+					m.sortColumn = col
+					m.sortAsc = true
+				}
+				m.updateTable()
+			}
+			return m, nil
+		}
+	case serverMsg:
+		if msg.api != m.api {
+			// Fetched from an environment that has since been switched away from.
+			return m, nil
+		}
+		m.loading = false
+		m.retry = retryingMsg{}
+		firstLoad := !m.loadedOnce
+		m.loadedOnce = true
+		m.fetchFailed = false
+		m.err = nil
+		// A poll may land before an in-flight delete completes.
+		servers := make([]Server, 0, len(msg.servers))
+		for _, server := range msg.servers {
+			if _, ok := m.pendingDeletes[server.Name]; !ok {
+				servers = append(servers, server)
+			}
+		}
+		m.trackStatusChanges(servers)
+		delta := diffInventories(m.servers, servers)
+		// updateTable re-applies m.filterQuery, so a refresh mid-typing keeps the filter.
+		m.servers = servers
+		for _, pending := range m.pendingEdits {
+			m.replaceServer(pending.server)
+		}
+		m.rawResponse = msg.raw
+		m.updateTable()
+		m.message = fmt.Sprintf("Inventory refreshed at %s", time.Now().Format("15:04:05"))
+		if summary := delta.summary(); summary != "" && !firstLoad {
+			m.message += " — " + summary
+		}
+		if msg.skipped > 0 {
+			m.message += fmt.Sprintf(" — %d records skipped due to parse errors", msg.skipped)
+		}
+		if msg.truncated > 0 {
+			m.message += fmt.Sprintf(" — truncated to %d servers (%d more not shown)", len(msg.servers)+msg.skipped, msg.truncated)
+		}
+		if msg.skipped > 0 || msg.truncated > 0 {
+			// Keep the warning on screen rather than letting it time out.
+			m.currentMsgStyle = m.cancelStyle
+		} else {
+			m.setTempMessage(m.successStyle, m.message)
+		}
+		var cmds []tea.Cmd
+		if m.config != nil && m.config.HistoryFile != "" {
+			cmds = append(cmds, recordHistory(m.config.HistoryFile, msg.servers))
+		}
+		if m.config != nil && m.config.SummaryEndpoint != "" {
+			cmds = append(cmds, fetchSummary(m.api))
+		}
+		if len(cmds) > 0 {
+			return m, tea.Batch(cmds...)
+		}
+	case createdMsg:
+		m.loading = false
+		delete(m.pendingEdits, msg.server.Name)
+		m.state = AddAnother
+		m.table.Blur()
+		m.lastCreated = msg.server
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Created server '%s'.", msg.server.Name))
+		return m, nil
+	case historyLoadedMsg:
+		m.state = History
+		m.table.Blur()
+		m.historyView.SetContent(m.historyText(msg.entries))
+		m.historyView.GotoTop()
+		return m, nil
+	case bulkProgressMsg:
+		doing, done := "Updating", "Updated"
+		switch msg.action {
+		case "delete":
+			doing, done = "Deleting", "Deleted"
+		case "decommission":
+			doing, done = "Decommissioning", "Decommissioned"
+		case "import":
+			doing = "Importing"
+		}
+		if msg.done < msg.total {
+			m.message = fmt.Sprintf("%s %d/%d servers...", doing, msg.done, msg.total)
+			return m, waitForBulk(m.bulkProgress)
+		}
+		m.loading = false
+		if msg.action == "import" {
+			return m.Update(importResult(m.importPlan, msg))
+		}
+		if len(msg.failed) > 0 {
+			m.message = fmt.Sprintf("%s %d of %d servers. Failed: %s", done, msg.total-len(msg.failed), msg.total, strings.Join(msg.failed, ", "))
+			m.currentMsgStyle = m.cancelStyle
+		} else {
+			m.setTempMessage(m.successStyle, fmt.Sprintf("%s %d servers.", done, msg.total))
+		}
+		if msg.action == "delete" {
+			return m, tea.Batch(fetchServers(m.api, m.metrics), m.announceDeletes(msg.succeeded))
+		}
+		return m, fetchServers(m.api, m.metrics)
+	case editorClosedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			m.message = fmt.Sprintf("Editor failed: %v", msg.err)
+			m.currentMsgStyle = m.cancelStyle
+			return m, nil
+		}
+		m.setTempMessage(m.messageStyle, "Reloading config...")
+		return m, reloadConfig(m.envName)
+	case configReloadedMsg:
+		changedAPI := msg.env.ApiBaseURL != m.apiBaseURL || msg.env.ApiToken != m.apiToken
+		m.applyConfig(msg.config, msg.httpClient, msg.envName, msg.env)
+		m.updateTable()
+		m.setTempMessage(m.successStyle, "Config reloaded.")
+		if changedAPI {
+			m.loading = true
+			return m, fetchServers(m.api, m.metrics)
+		}
+		return m, nil
+	case importLoadedMsg:
+		m.importPlan = analyzeImport(msg.servers, m.servers)
+		m.state = ImportConfirm
+		m.table.Blur()
+		m.message = fmt.Sprintf("Read %d servers from %s.", len(msg.servers), msg.path)
+		m.currentMsgStyle = m.messageStyle
+		return m, nil
+	case importDoneMsg:
+		text := fmt.Sprintf("Imported: %d created, %d overwritten, %d skipped.", msg.created, msg.updated, msg.skipped)
+		if len(msg.failed) > 0 {
+			m.message = text + fmt.Sprintf(" Failed: %s", strings.Join(msg.failed, ", "))
+			m.currentMsgStyle = m.cancelStyle
+		} else {
+			m.setTempMessage(m.successStyle, text)
+		}
+		return m, fetchServers(m.api, m.metrics)
+	case exportedMsg:
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Exported %d %s servers to %s", msg.count, msg.scope, msg.path))
+	case snapshotMsg:
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Saved the current view to %s and %s", msg.textPath, msg.csvPath))
+	case serverRefreshedMsg:
+		m.loading = false
+		m.err = nil
+		for i, server := range m.servers {
+			if server.Name == msg.server.Name {
+				m.servers[i] = msg.server
+			}
+		}
+		m.updateTable()
+		m.flashRow = msg.server.Name
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Refreshed %s at %s", msg.server.Name, time.Now().Format("15:04:05")))
+	case savedMsg:
+		delete(m.pendingEdits, msg.server.Name)
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Saved server '%s'.", msg.server.Name))
+		return m, fetchServers(m.api, m.metrics)
+	case saveFailedMsg:
+		m.rollbackPendingEdit(msg.server.Name)
+		m.updateTable()
+		m.err = msg.err
+		m.message = fmt.Sprintf("Could not save '%s': %v", msg.server.Name, msg.err)
+		m.currentMsgStyle = m.cancelStyle
+	case deleteDoneMsg:
+		delete(m.pendingDeletes, msg.name)
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Deleted server '%s'.", msg.name))
+		return m, tea.Batch(fetchServers(m.api, m.metrics), m.announceDeletes([]string{msg.name}))
+	case decommissionedMsg:
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Decommissioned server '%s'.", msg.name))
+		return m, fetchServers(m.api, m.metrics)
+	case deleteFailedMsg:
+		if pending, ok := m.pendingDeletes[msg.name]; ok {
+			delete(m.pendingDeletes, msg.name)
+			i := min(pending.index, len(m.servers))
+			m.servers = append(m.servers[:i], append([]Server{pending.server}, m.servers[i:]...)...)
+			m.updateTable()
+		}
+		m.err = msg.err
+		m.message = fmt.Sprintf("Could not delete '%s': %v", msg.name, msg.err)
+		m.currentMsgStyle = m.cancelStyle
+	case errMsg:
+		if msg.fetch && msg.api != m.api {
+			return m, nil
+		}
+		m.loading = false
+		m.retry = retryingMsg{}
+		m.err = msg
+		if msg.fetch {
+			// Only a successful fetch clears this; other errors say nothing about the inventory.
+			m.fetchFailed = true
+		}
+		m.message = m.err.Error()
 		m.currentMsgStyle = m.cancelStyle // Use cancel style for errors
+		if msg.fetch && !m.loadedOnce && m.startupAttempts < startupRetries {
+			// Until the first successful load, retry with a doubling delay.
+			delay := min(startupRetryBase<<m.startupAttempts, startupRetryMax)
+			m.startupAttempts++
+			m.message = fmt.Sprintf("%s — retrying in %ds...", m.err.Error(), int(delay.Seconds()))
+			return m, tea.Tick(delay, func(time.Time) tea.Msg { return retryFetchMsg{} })
+		}
+	case retryFetchMsg:
+		if !m.loadedOnce {
+			m.loading = true
+			return m, fetchServers(m.api, m.metrics)
+		}
 	case fetchServersMsg:
-		// Pass the token for polling updates
-		return m, fetchServers(m.apiBaseURL, m.apiToken)
+		return m, m.poll(msg)
+	case summaryMsg:
+		m.summaryCounts = msg.counts
+		return m, nil
 	case clearMessage:
 		m.currentMsgStyle = m.messageStyle
+		m.flashRow = ""
+	}
+	if m.filtering {
+		// Keep the filter's cursor blinking while background updates arrive.
+		var filterCmd tea.Cmd
+		m.filterInput, filterCmd = m.filterInput.Update(msg)
+		m.table, cmd = m.table.Update(msg)
+		return m, tea.Batch(cmd, filterCmd)
 	}
 	m.table, cmd = m.table.Update(msg)
 	return m, cmd
 }
 
+// openForm starts the add/edit wizard at its first step with the fields of
+// server pre-filled. original is what an edit's confirmation diffs against.
+func (m model) openForm(state State, server, original Server) (tea.Model, tea.Cmd) {
+	if m.inFlight(server.Name) {
+		m.setTempMessage(m.cancelStyle, fmt.Sprintf("'%s' has a change in flight; try again once it finishes.", server.Name))
+		return m, nil
+	}
+	m.state = state
+	m.table.Blur()
+	m.addingState = InputName
+	m.currentServer = server
+	m.originalServer = original
+	m.staleConfirmed = false
+	m.textInput.Placeholder = "Name"
+	m.textInput.Focus()
+	m.textInput.SetValue(server.Name)
+	for i, status := range statuses {
+		if status == server.Status {
+			m.statusList.Select(i)
+		}
+	}
+	if state == Adding {
+		m.message = "Adding new server (Step 1 of 5):"
+	} else {
+		m.message = "Editing server (Step 1 of 5):"
+	}
+	m.currentMsgStyle = m.messageStyle
+	return m, textinput.Blink
+}
+
+// staleOnlineWarning reports whether an edit sets a server Online even though
+// its last report is older than the stale threshold.
+func (m model) staleOnlineWarning() bool {
+	return m.state == Editing && m.currentServer.Status == "Online" && m.isStale(m.currentServer, time.Now())
+}
+
+// editableFields copies the fields the wizard edits, plus tags so saving
+// doesn't drop them; audit fields are owned by the backend.
+func editableFields(server Server) Server {
+	return Server{
+		Name:       server.Name,
+		IP:         server.IP,
+		Location:   server.Location,
+		Status:     server.Status,
+		LastReport: server.LastReport,
+		Services:   server.Services,
+		Tags:       server.Tags,
+	}
+}
+
+// updateFilter handles typing in the filter input, re-filtering on every keystroke.
+func updateFilter(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "esc":
+		m.filtering = false
+		m.filterQuery = ""
+		m.filterInput.Blur()
+		m.table.Focus()
+		m.updateTable()
+		return m, nil
+	case "enter":
+		// Keep the query applied and hand the keys back to the table.
+		m.filtering = false
+		m.filterInput.Blur()
+		m.table.Focus()
+		return m, nil
+	}
+	m.filterInput, cmd = m.filterInput.Update(msg)
+	m.filterQuery = m.filterInput.Value()
+	m.updateTable()
+	return m, cmd
+}
+
+// updateColumnFilter handles typing into the per-column filters: tab moves
+// between columns, Enter keeps the filters, Esc clears them.
+func updateColumnFilter(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "esc":
+		m.columnFiltering = false
+		m.clearColumnFilters()
+		m.table.Focus()
+		m.updateTable()
+		return m, nil
+	case "enter":
+		m.columnFiltering = false
+		m.columnFilters[m.columnFocus].Blur()
+		m.table.Focus()
+		return m, nil
+	case "tab", "shift+tab":
+		m.columnFilters[m.columnFocus].Blur()
+		step := 1
+		if msg.String() == "shift+tab" {
+			step = len(m.columnFilters) - 1
+		}
+		m.columnFocus = (m.columnFocus + step) % len(m.columnFilters)
+		return m, m.columnFilters[m.columnFocus].Focus()
+	}
+	m.columnFilters[m.columnFocus], cmd = m.columnFilters[m.columnFocus].Update(msg)
+	m.updateTable()
+	return m, cmd
+}
+
+// clearColumnFilters empties every per-column filter.
+func (m *model) clearColumnFilters() {
+	for i := range m.columnFilters {
+		m.columnFilters[i].SetValue("")
+		m.columnFilters[i].Blur()
+	}
+}
+
+// updateMark finishes an "m<key>" or "'<key>" sequence: m sets the mark to
+// the server under the cursor, ' jumps back to it. Marks follow the server,
+// not the row, so they survive refreshes and re-sorting.
+func updateMark(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
+	command := m.markPending
+	m.markPending = ""
+	key := msg.String()
+	if msg.Type != tea.KeyRunes || len(msg.Runes) != 1 {
+		return m, nil // Esc or any other special key cancels
+	}
+	if command == "m" {
+		if server, ok := m.selectedServer(); ok {
+			m.marks[key] = server.Name
+			m.setTempMessage(m.successStyle, fmt.Sprintf("Mark '%s' set on '%s'.", key, server.Name))
+		}
+		return m, nil
+	}
+	name, ok := m.marks[key]
+	if !ok {
+		m.setTempMessage(m.cancelStyle, fmt.Sprintf("Mark '%s' is not set.", key))
+		return m, nil
+	}
+	if !slices.ContainsFunc(m.servers, func(server Server) bool { return server.Name == name }) {
+		m.setTempMessage(m.cancelStyle, fmt.Sprintf("'%s' (mark '%s') is no longer in the inventory.", name, key))
+		return m, nil
+	}
+	m.focusServer(name)
+	return m, nil
+}
+
+// updatePollInterval handles the poll interval mode: '+' doubles the interval
+// and '-' halves it, within minPollInterval and maxPollInterval.
+func updatePollInterval(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
+	interval := m.pollInterval
+	switch msg.String() {
+	case "+", "=":
+		interval = min(interval*2, maxPollInterval)
+	case "-", "_":
+		interval = max(interval/2, minPollInterval)
+	case "esc", "enter", "ctrl+t":
+		m.adjustingPoll = false
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Polling every %s.", m.pollInterval))
+		return m, nil
+	case "ctrl+c":
+		return m, tea.Quit
+	}
+	m.message = fmt.Sprintf("Polling every %s: '+' to double, '-' to halve, 'Esc' when done", interval)
+	if interval == m.pollInterval {
+		return m, nil
+	}
+	// Start a fresh schedule at the new interval; the pending tick is ignored.
+	m.pollInterval = interval
+	m.pollGen++
+	cmds := []tea.Cmd{m.schedulePoll()}
+	if m.config.RememberPollInterval {
+		cmds = append(cmds, savePollInterval(m.config.path, int(interval.Seconds())))
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// schedulePoll schedules the next background refresh at the current interval.
+func (m model) schedulePoll() tea.Cmd {
+	return pollForUpdates(m.pollInterval, m.pollJitter, m.pollGen)
+}
+
+// poll refreshes the inventory and schedules the next poll, unless msg comes
+// from a schedule replaced by an interval change.
+func (m model) poll(msg fetchServersMsg) tea.Cmd {
+	if msg.gen != m.pollGen {
+		return nil
+	}
+	return tea.Batch(fetchServers(m.api, m.metrics), m.schedulePoll())
+}
+
+// updateResize handles the column width mode: tab picks a column, +/- resize it.
+func updateResize(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "tab", "right", "l":
+		m.resizeColumn = (m.resizeColumn + 1) % len(columnTitles)
+	case "shift+tab", "left", "h":
+		m.resizeColumn = (m.resizeColumn + len(columnTitles) - 1) % len(columnTitles)
+	case "+", "=":
+		m.columnWidths[m.resizeColumn] = min(m.columnWidths[m.resizeColumn]+2, maxColumnWidth)
+	case "-", "_":
+		m.columnWidths[m.resizeColumn] = max(m.columnWidths[m.resizeColumn]-2, minColumnWidth)
+	case "esc", "enter", "W":
+		m.resizing = false
+		widths, _ := json.Marshal(m.columnWidths)
+		m.message = fmt.Sprintf("To keep these widths, set \"columnWidths\": %s in the config.", widths)
+		m.currentMsgStyle = m.messageStyle
+	case "ctrl+c":
+		return m, tea.Quit
+	}
+	m.updateTable()
+	return m, nil
+}
+
 // updateAddingEditing handles logic for the add/edit forms.
 func updateAddingEditing(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
@@ -288,8 +1929,12 @@ func updateAddingEditing(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
 	}
 
 	switch m.addingState {
-	case InputName, InputIP, InputLocation:
+	case InputName, InputIP, InputLocation, InputServices:
 		m.textInput, cmd = m.textInput.Update(msg)
+		if m.addingState == InputIP {
+			// Re-validate on every keystroke so the indicator stays live.
+			m.ipValid = validIP(m.textInput.Value())
+		}
 		if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.String() == "enter" {
 			switch m.addingState {
 			case InputName:
@@ -297,25 +1942,36 @@ func updateAddingEditing(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
 				m.addingState = InputIP
 				m.textInput.Placeholder = "IP Address"
 				m.textInput.SetValue(m.currentServer.IP)
-				m.message = "Adding new server (Step 2 of 4):"
+				m.ipValid = validIP(m.currentServer.IP)
+				m.message = "Adding new server (Step 2 of 5):"
 			case InputIP:
 				m.currentServer.IP = m.textInput.Value()
 				m.addingState = InputLocation
 				m.textInput.Placeholder = "Location"
 				m.textInput.SetValue(m.currentServer.Location)
-				m.message = "Adding new server (Step 3 of 4):"
+				m.message = "Adding new server (Step 3 of 5):"
 			case InputLocation:
 				m.currentServer.Location = m.textInput.Value()
+				m.addingState = InputServices
+				m.textInput.Placeholder = "Services"
+				m.textInput.SetValue(strings.Join(m.currentServer.Services, ", "))
+				m.message = "Adding new server (Step 4 of 5):"
+			case InputServices:
+				m.currentServer.Services = parseServices(m.textInput.Value())
 				m.addingState = InputStatus
 				m.textInput.Blur()
-				m.message = "Adding new server (Step 4 of 4):"
+				m.message = "Adding new server (Step 5 of 5):"
 			}
 			return m, textinput.Blink
 		}
 	case InputStatus:
 		m.statusList, cmd = m.statusList.Update(msg)
 		if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.String() == "enter" {
-			selectedStatus := m.statusList.SelectedItem().(statusItem)
+			// A filter that matches nothing leaves no status to pick.
+			selectedStatus, ok := m.statusList.SelectedItem().(statusItem)
+			if !ok {
+				return m, cmd
+			}
 			m.currentServer.Status = string(selectedStatus)
 			m.addingState = Confirm
 			m.message = "" // Clear message for the combined confirmation view
@@ -324,12 +1980,28 @@ func updateAddingEditing(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
 		if keyMsg, ok := msg.(tea.KeyMsg); ok {
 			switch keyMsg.String() {
 			case "y", "Y":
+				if m.staleOnlineWarning() && !m.staleConfirmed {
+					// Soft check: a second 'y' submits anyway.
+					m.staleConfirmed = true
+					return m, nil
+				}
+				adding := m.state == Adding
+				m.lastAction, m.lastServer = m.state, m.currentServer
 				m.state = Viewing
-				m.loading = true
 				m.table.Focus()
+				if m.inFlight(m.currentServer.Name) {
+					// A second submit would race the first; '.' resubmits later.
+					m.setTempMessage(m.cancelStyle, fmt.Sprintf("'%s' is still being saved; press '.' to submit again once it finishes.", m.currentServer.Name))
+					return m, nil
+				}
+				m.applyPendingEdit(m.currentServer)
+				m.updateTable()
 				m.setTempMessage(m.successStyle, "Submitting server data...")
-				// Pass the token when adding/editing
-				return m, addOrEditServer(m.apiBaseURL, m.apiToken, m.currentServer)
+				// New servers are created, existing ones updated
+				if adding {
+					return m, createServer(m.api, m.currentServer)
+				}
+				return m, addOrEditServer(m.api, m.currentServer)
 			case "n", "N", "esc":
 				m.state = Viewing
 				m.table.Focus()
@@ -340,17 +2012,78 @@ func updateAddingEditing(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// inFlight reports whether an add, edit or delete of name is still waiting
+// for the API, so that a second request for it can be refused.
+func (m model) inFlight(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, editing := m.pendingEdits[name]
+	_, deleting := m.pendingDeletes[name]
+	return editing || deleting
+}
+
+// replaceServer swaps in server for the row with the same name, or appends it.
+func (m *model) replaceServer(server Server) {
+	for i := range m.servers {
+		if m.servers[i].Name == server.Name {
+			m.servers[i] = server
+			return
+		}
+	}
+	m.servers = append(m.servers, server)
+}
+
+// applyPendingEdit shows server in the table before the API has confirmed it.
+func (m *model) applyPendingEdit(server Server) {
+	pending := pendingEdit{server: server}
+	if earlier, ok := m.pendingEdits[server.Name]; ok {
+		// Keep the state from before the first unconfirmed change.
+		pending.previous, pending.existed = earlier.previous, earlier.existed
+	} else {
+		for _, existing := range m.servers {
+			if existing.Name == server.Name {
+				pending.previous, pending.existed = existing, true
+			}
+		}
+	}
+	if pending.existed && server.LastReport == "" {
+		// The form doesn't carry the report time; keep showing the old one.
+		server.LastReport = pending.previous.LastReport
+		pending.server = server
+	}
+	m.pendingEdits[server.Name] = pending
+	m.replaceServer(server)
+}
+
+// rollbackPendingEdit restores the row an optimistic add or edit replaced.
+func (m *model) rollbackPendingEdit(name string) {
+	pending, ok := m.pendingEdits[name]
+	if !ok {
+		return
+	}
+	delete(m.pendingEdits, name)
+	if pending.existed {
+		m.replaceServer(pending.previous)
+		return
+	}
+	for i, server := range m.servers {
+		if server.Name == name {
+			m.servers = append(m.servers[:i:i], m.servers[i+1:]...)
+			return
+		}
+	}
+}
+
 // updateDeleting handles logic for the delete confirmation.
 func updateDeleting(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	if m.strictDelete {
+		return updateStrictDeleting(msg, m)
+	}
 	if keyMsg, ok := msg.(tea.KeyMsg); ok {
 		switch keyMsg.String() {
 		case "y", "Y":
-			m.state = Viewing
-			m.loading = true
-			m.table.Focus()
-			m.setTempMessage(m.successStyle, fmt.Sprintf("Deleting server '%s'...", m.deleteTarget))
-			// Pass the token when deleting
-			return m, deleteServer(m.apiBaseURL, m.apiToken, m.deleteTarget)
+			return m.startDelete()
 		case "n", "N", "esc":
 			m.state = Viewing
 			m.table.Focus()
@@ -360,298 +2093,4002 @@ func updateDeleting(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-// updateHelp handles logic for the help view.
-func updateHelp(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
-	if _, ok := msg.(tea.KeyMsg); ok {
-		m.state = Viewing
+// updateStrictDeleting confirms a production delete by having the name, or
+// DELETE, typed out instead of a single keypress.
+func updateStrictDeleting(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.state = Viewing
+			m.textInput.Blur()
+			m.table.Focus()
+			m.setTempMessage(m.cancelStyle, "Deletion cancelled.")
+			return m, nil
+		case "enter":
+			typed := strings.TrimSpace(m.textInput.Value())
+			if m.deleteBatch != nil {
+				if typed != "yes" {
+					m.message = "Type 'yes' to confirm, or press Esc to cancel."
+					m.currentMsgStyle = m.cancelStyle
+					return m, nil
+				}
+				m.textInput.Blur()
+				return m.startDelete()
+			}
+			if typed != m.deleteTarget && typed != "DELETE" {
+				m.message = "That doesn't match; type the server name or DELETE."
+				m.currentMsgStyle = m.cancelStyle
+				return m, nil
+			}
+			m.textInput.Blur()
+			return m.startDelete()
+		}
 	}
-	return m, nil
+	m.textInput, cmd = m.textInput.Update(msg)
+	return m, cmd
 }
 
-// --- VIEW ---
-
-// View renders the TUI to the terminal.
-func (m model) View() string {
-	if m.state == Help {
-		return m.helpView()
+// chooseDelete starts deleting name. Backends with soft delete first get a
+// choice between decommissioning and permanently deleting.
+func (m model) chooseDelete(name string) (tea.Model, tea.Cmd) {
+	if m.inFlight(name) {
+		m.setTempMessage(m.cancelStyle, fmt.Sprintf("'%s' has a change in flight; try again once it finishes.", name))
+		return m, nil
 	}
-
-	s := ""
-	s += m.headerStyle.Render("Server Inventory Dashboard") + "\n\n"
-
-	if m.loading {
-		s += m.spinnerStyle.Render("⠋") + " Loading..."
-	} else {
-		s += m.currentMsgStyle.Render(m.message)
+	if m.config == nil || !m.config.SoftDeleteSupported {
+		return m.confirmDelete(name, false)
 	}
-	s += "\n\n"
+	m.deleteTarget = name
+	m.deleteBatch = nil
+	m.deleteOptions.Select(0)
+	m.state = DeleteChoice
+	m.table.Blur()
+	m.message = fmt.Sprintf("Remove '%s':", name)
+	m.currentMsgStyle = m.messageStyle
+	return m, nil
+}
 
-	switch m.state {
-	case Viewing:
-		s += m.viewingView()
-	case Adding, Editing:
-		s += m.addingEditingView()
-	case Deleting:
-		s += fmt.Sprintf("Are you sure you want to delete '%s'?\n\n", m.deleteTarget) + m.messageStyle.Render("Press 'y' to confirm, 'n' or 'Esc' to cancel.")
+// chooseBulkDelete starts deleting the selected servers, offering the same
+// choice as chooseDelete when the backend supports soft delete.
+func (m model) chooseBulkDelete() (tea.Model, tea.Cmd) {
+	if m.config == nil || !m.config.SoftDeleteSupported {
+		return m.confirmBulkDelete(false)
 	}
+	m.deleteBatch = m.selectedServers()
+	m.deleteOptions.Select(0)
+	m.state = DeleteChoice
+	m.table.Blur()
+	m.message = fmt.Sprintf("Remove %d servers:", len(m.deleteBatch))
+	m.currentMsgStyle = m.messageStyle
+	return m, nil
+}
 
+// updateDeleteChoice picks between decommissioning and deleting deleteTarget,
+// or deleteBatch when several servers are selected.
+func updateDeleteChoice(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.state = Viewing
+			m.table.Focus()
+			m.setTempMessage(m.cancelStyle, "Deletion cancelled.")
+			return m, nil
+		case "enter":
+			soft := m.deleteOptions.SelectedItem() == optionDecommission
+			if m.deleteBatch != nil {
+				return m.confirmBulkDelete(soft)
+			}
+			return m.confirmDelete(m.deleteTarget, soft)
+		}
+	}
+	m.deleteOptions, cmd = m.deleteOptions.Update(msg)
+	return m, cmd
+}
+
+// confirmDelete opens the delete confirmation for name, asking for the name to
+// be typed when it or the environment matches the production pattern. With
+// soft set the server is decommissioned rather than deleted.
+func (m model) confirmDelete(name string, soft bool) (tea.Model, tea.Cmd) {
+	m.deleteTarget = name
+	m.deleteBatch = nil
+	m.softDelete = soft
+	m.state = Deleting
+	m.message = ""
+	m.strictDelete = m.productionRe != nil && (m.productionRe.MatchString(name) || m.productionRe.MatchString(m.envName))
+	if !m.strictDelete {
+		return m, nil
+	}
+	m.table.Blur()
+	m.textInput.Placeholder = name
+	m.textInput.SetValue("")
+	return m, m.textInput.Focus()
+}
+
+// confirmBulkDelete opens the delete confirmation for the selected servers.
+// Large selections, or any in production, must be confirmed by typing 'yes'.
+// With soft set the servers are decommissioned rather than deleted.
+func (m model) confirmBulkDelete(soft bool) (tea.Model, tea.Cmd) {
+	m.deleteBatch = m.selectedServers()
+	m.softDelete = soft
+	m.state = Deleting
+	m.message = ""
+	m.strictDelete = len(m.deleteBatch) > m.config.BulkDeleteConfirmAt
+	if m.productionRe != nil {
+		m.strictDelete = m.strictDelete || m.productionRe.MatchString(m.envName)
+		for _, server := range m.deleteBatch {
+			m.strictDelete = m.strictDelete || m.productionRe.MatchString(server.Name)
+		}
+	}
+	if !m.strictDelete {
+		return m, nil
+	}
+	m.table.Blur()
+	m.textInput.Placeholder = "yes"
+	m.textInput.SetValue("")
+	return m, m.textInput.Focus()
+}
+
+// startDelete removes the confirmed server from the table and deletes it through the API.
+func (m model) startDelete() (tea.Model, tea.Cmd) {
+	if m.deleteBatch != nil {
+		servers := m.deleteBatch
+		m.deleteBatch = nil
+		m.state = Viewing
+		m.table.Focus()
+		m.selected = map[string]bool{}
+		m.loading = true
+		m.currentMsgStyle = m.messageStyle
+		if m.softDelete {
+			m.message = fmt.Sprintf("Decommissioning 0/%d servers...", len(servers))
+			m.bulkProgress = runBulkDecommission(m.api, servers, m.config.DecommissionStatus, m.config.MaxConcurrency)
+		} else {
+			m.message = fmt.Sprintf("Deleting 0/%d servers...", len(servers))
+			m.bulkProgress = runBulkDelete(m.api, servers, m.config.MaxConcurrency)
+		}
+		return m, waitForBulk(m.bulkProgress)
+	}
+	if m.softDelete {
+		m.state = Viewing
+		m.table.Focus()
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Decommissioning server '%s'...", m.deleteTarget))
+		return m, decommissionServer(m.api, m.deleteTarget, m.config.DecommissionStatus)
+	}
+	m.lastAction, m.lastServer = Deleting, Server{Name: m.deleteTarget}
+	m.state = Viewing
+	m.table.Focus()
+	if m.inFlight(m.deleteTarget) {
+		m.setTempMessage(m.cancelStyle, fmt.Sprintf("'%s' is already being deleted.", m.deleteTarget))
+		return m, nil
+	}
+	// Remove the row right away; it is put back if the API call fails.
+	for i, server := range m.servers {
+		if server.Name == m.deleteTarget {
+			m.pendingDeletes[server.Name] = pendingDelete{server: server, index: i}
+			m.servers = append(m.servers[:i:i], m.servers[i+1:]...)
+			break
+		}
+	}
+	m.updateTable()
+	m.setTempMessage(m.successStyle, fmt.Sprintf("Deleting server '%s'...", m.deleteTarget))
+	return m, deleteServer(m.api, m.deleteTarget)
+}
+
+// updateSwitchingEnv handles logic for the environment switcher.
+func updateSwitchingEnv(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.state = Viewing
+			m.table.Focus()
+			m.setTempMessage(m.cancelStyle, "Cancelled.")
+			return m, nil
+		case "enter":
+			name := string(m.envList.SelectedItem().(envItem))
+			env := m.environments[name]
+			m.state = Viewing
+			m.table.Focus()
+			m.envName = name
+			m.apiBaseURL = env.ApiBaseURL
+			m.apiToken = env.ApiToken
+			m.api = newTUIClient(m.apiBaseURL, m.apiToken, m.httpClient, m.config, m.notify)
+			m.applyTheme(env.Theme)
+			m.resetEnvironmentState()
+			m.updateTable()
+			m.loading = true
+			m.message = fmt.Sprintf("Switched to %s, loading...", name)
+			m.currentMsgStyle = m.messageStyle
+			return m, fetchServers(m.api, m.metrics)
+		}
+	}
+	m.envList, cmd = m.envList.Update(msg)
+	return m, cmd
+}
+
+// resetEnvironmentState forgets everything tied to the previous environment's
+// servers, so that nothing keyed by name carries over to a server of the same
+// name elsewhere. Results still on their way from the old environment are
+// dropped on arrival since they come from a different API client.
+func (m *model) resetEnvironmentState() {
+	m.servers = nil
+	m.summaryCounts = nil
+	m.rawResponse = nil
+	m.deferred = nil
+	m.selected = map[string]bool{}
+	m.marks = map[string]string{}
+	m.compareBase = ""
+	m.pendingEdits = map[string]pendingEdit{}
+	m.pendingDeletes = map[string]pendingDelete{}
+	m.lastAction, m.lastServer, m.lastCreated = Viewing, Server{}, Server{}
+	m.changedAt = map[string]time.Time{}
+	m.flashRow = ""
+	m.locationOnly = ""
+}
+
+// updateDetail handles logic for the server detail view.
+func updateDetail(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc", "enter", "q":
+			m.state = Viewing
+			m.table.Focus()
+		}
+	}
+	return m, nil
+}
+
+// openCompare shows the selected server side by side with the compare base.
+func (m model) openCompare() (tea.Model, tea.Cmd) {
+	server, ok := m.selectedServer()
+	if !ok {
+		return m, nil
+	}
+	if m.compareBase == "" {
+		m.setTempMessage(m.cancelStyle, "Press '=' on a server to mark it as the compare base first.")
+		return m, nil
+	}
+	if server.Name == m.compareBase {
+		m.setTempMessage(m.cancelStyle, "Select a different server to compare against the base.")
+		return m, nil
+	}
+	i := slices.IndexFunc(m.servers, func(s Server) bool { return s.Name == m.compareBase })
+	if i < 0 {
+		m.setTempMessage(m.cancelStyle, fmt.Sprintf("Compare base '%s' is no longer in the inventory.", m.compareBase))
+		m.compareBase = ""
+		return m, nil
+	}
+	m.comparePair = [2]Server{m.servers[i], server}
+	m.state = Comparing
+	m.table.Blur()
+	return m, nil
+}
+
+// updatePicking runs the fullscreen server picker. Enter focuses the chosen
+// server in the table, clearing any filter that hides it; Esc cancels.
+func updatePicking(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.state = Viewing
+			m.table.Focus()
+			return m, nil
+		case "enter":
+			item, ok := m.picker.SelectedItem().(serverItem)
+			if !ok {
+				return m, nil
+			}
+			m.state = Viewing
+			m.table.Focus()
+			m.focusServer(string(item))
+			return m, nil
+		}
+	}
+	m.picker, cmd = m.picker.Update(msg)
+	return m, cmd
+}
+
+// focusServer moves the table cursor to the named server, first clearing the
+// filters if they hide it.
+func (m *model) focusServer(name string) {
+	cleared := false
+	for _, server := range m.servers {
+		if server.Name != name || m.shown(server, time.Now()) {
+			continue
+		}
+		m.filterQuery = ""
+		m.staleOnly = false
+		m.locationOnly = ""
+		m.columnFiltering = false
+		m.clearColumnFilters()
+		m.statusFilter[server.Status] = true
+		if m.pinView == pinsOnly {
+			m.pinView = pinsInline
+		}
+		m.updateTable()
+		cleared = true
+	}
+	for i, server := range m.visible {
+		if server.Name == name {
+			m.table.SetCursor(i)
+			if cleared {
+				m.setTempMessage(m.cancelStyle, fmt.Sprintf("Filters cleared to show '%s'.", name))
+			}
+			return
+		}
+	}
+}
+
+// updateTouching confirms re-reporting touchTarget unchanged, which nudges a
+// backend whose heartbeat is stuck into marking it as just reported.
+func updateTouching(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	switch keyMsg.String() {
+	case "y", "Y":
+		m.state = Viewing
+		m.table.Focus()
+		name := m.touchTarget.Name
+		if m.inFlight(name) {
+			m.setTempMessage(m.cancelStyle, fmt.Sprintf("'%s' has a change in flight; try again once it finishes.", name))
+			return m, nil
+		}
+		// The row doesn't change, but edits and deletes must wait for the touch.
+		m.pendingEdits[name] = pendingEdit{server: m.touchTarget, previous: m.touchTarget, existed: true}
+		m.message = fmt.Sprintf("Re-sending a report for '%s'...", name)
+		m.currentMsgStyle = m.messageStyle
+		return m, addOrEditServer(m.api, editableFields(m.touchTarget))
+	case "n", "N", "esc":
+		m.state = Viewing
+		m.table.Focus()
+		m.setTempMessage(m.cancelStyle, "Cancelled.")
+	}
+	return m, nil
+}
+
+// updateBulkStatus picks a status for the selected servers and confirms the change.
+func updateBulkStatus(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	keyMsg, isKey := msg.(tea.KeyMsg)
+	if isKey && keyMsg.String() == "esc" {
+		m.state = Viewing
+		m.table.Focus()
+		m.setTempMessage(m.cancelStyle, "Cancelled.")
+		return m, nil
+	}
+	if m.state == BulkStatus {
+		m.statusList, cmd = m.statusList.Update(msg)
+		if isKey && keyMsg.String() == "enter" {
+			status, ok := m.statusList.SelectedItem().(statusItem)
+			if !ok {
+				return m, cmd
+			}
+			m.bulkStatus = string(status)
+			m.state = BulkConfirm
+			m.message = ""
+		}
+		return m, cmd
+	}
+	if isKey {
+		switch keyMsg.String() {
+		case "y", "Y":
+			var servers []Server
+			for _, server := range m.selectedServers() {
+				updated := editableFields(server)
+				updated.Status = m.bulkStatus
+				servers = append(servers, updated)
+			}
+			m.state = Viewing
+			m.table.Focus()
+			m.selected = map[string]bool{}
+			m.loading = true
+			m.message = fmt.Sprintf("Updating 0/%d servers...", len(servers))
+			m.currentMsgStyle = m.messageStyle
+			m.bulkProgress = runBulkUpdate(m.api, servers, m.config.MaxConcurrency)
+			return m, waitForBulk(m.bulkProgress)
+		case "n", "N":
+			m.state = Viewing
+			m.table.Focus()
+			m.setTempMessage(m.cancelStyle, "Cancelled.")
+		}
+	}
+	return m, nil
+}
+
+// updateHistory scrolls through the recorded inventory changes.
+func updateHistory(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc", "q", "h":
+			m.state = Viewing
+			m.table.Focus()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.historyView, cmd = m.historyView.Update(msg)
+	return m, cmd
+}
+
+// updateRawResponse scrolls through the last inventory response body.
+func updateRawResponse(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc", "q", "ctrl+r":
+			m.state = Viewing
+			m.table.Focus()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.rawView, cmd = m.rawView.Update(msg)
+	return m, cmd
+}
+
+// prettyJSON indents a JSON body, returning it unchanged if it isn't valid JSON.
+func prettyJSON(raw []byte) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return out.String()
+}
+
+// updatePingAll collects sweep results as they stream in and handles cancelling.
+func updatePingAll(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case pingResultMsg:
+		if msg.sweep != m.ping.id {
+			return m, nil
+		}
+		m.ping.results[msg.result.name] = msg.result
+		return m, waitForPing(m.ping.id, m.ping.ch)
+	case pingDoneMsg:
+		if msg.sweep == m.ping.id {
+			m.ping.cancel()
+			m.ping.done = true
+		}
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "q", "P":
+			m.ping.cancel()
+			m.state = Viewing
+			m.table.Focus()
+			if !m.ping.done {
+				m.setTempMessage(m.cancelStyle, "Ping sweep cancelled.")
+			}
+		}
+	}
+	return m, nil
+}
+
+// updateImporting reads the path of the CSV file to import.
+func updateImporting(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.state = Viewing
+			m.textInput.Blur()
+			m.table.Focus()
+			m.setTempMessage(m.cancelStyle, "Import cancelled.")
+			return m, nil
+		case "enter":
+			path := strings.TrimSpace(m.textInput.Value())
+			if path == "" {
+				return m, nil
+			}
+			m.state = Viewing
+			m.textInput.Blur()
+			m.table.Focus()
+			m.message = ""
+			return m, loadImport(path)
+		}
+	}
+	m.textInput, cmd = m.textInput.Update(msg)
+	return m, cmd
+}
+
+// updateAnnotating reads the note for annotateTarget. An empty note clears it.
+func updateAnnotating(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.state = Viewing
+			m.textInput.Blur()
+			m.table.Focus()
+			m.setTempMessage(m.cancelStyle, "Note unchanged.")
+			return m, nil
+		case "enter":
+			m.state = Viewing
+			m.textInput.Blur()
+			m.table.Focus()
+			return m.setAnnotation(m.annotateTarget, strings.TrimSpace(m.textInput.Value()))
+		}
+	}
+	m.textInput, cmd = m.textInput.Update(msg)
+	return m, cmd
+}
+
+// setAnnotation sets or, when note is empty, clears the local note on a
+// server and saves the notes file.
+func (m model) setAnnotation(name, note string) (tea.Model, tea.Cmd) {
+	if note == "" {
+		delete(m.annotations, name)
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Cleared the note on '%s'.", name))
+	} else {
+		m.annotations[name] = note
+		m.setTempMessage(m.successStyle, fmt.Sprintf("Noted '%s': %s", name, note))
+	}
+	m.updateTable()
+	return m, saveAnnotations(annotationsPath(m.config), m.annotations)
+}
+
+// startImport creates the new servers of the confirmed import and overwrites
+// the given existing ones, reporting progress like the bulk actions.
+func (m model) startImport(overwrite []Server) (tea.Model, tea.Cmd) {
+	m.state = Viewing
+	m.table.Focus()
+	servers := append(append([]Server(nil), m.importPlan.added...), overwrite...)
+	if len(servers) == 0 {
+		return m.Update(importDoneMsg{skipped: len(m.importPlan.duplicates)})
+	}
+	m.loading = true
+	m.message = fmt.Sprintf("Importing 0/%d servers...", len(servers))
+	m.currentMsgStyle = m.messageStyle
+	m.bulkProgress = importServers(m.api, m.importPlan.added, overwrite, m.config.MaxConcurrency)
+	return m, waitForBulk(m.bulkProgress)
+}
+
+// updateImportConfirm lets the user decide what to do with servers that already exist.
+func updateImportConfirm(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "s", "S":
+			return m.startImport(nil)
+		case "o", "O":
+			return m.startImport(m.importPlan.duplicates)
+		case "n", "N", "esc":
+			m.state = Viewing
+			m.table.Focus()
+			m.setTempMessage(m.cancelStyle, "Import cancelled.")
+		}
+	}
+	return m, nil
+}
+
+// updateAddAnother handles the "Add another?" prompt shown after creating a server.
+func updateAddAnother(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "y", "Y":
+			// Racks are usually onboarded together, so keep where and how the last one was added.
+			return m.openForm(Adding, Server{Location: m.lastCreated.Location, Status: m.lastCreated.Status}, Server{})
+		case "n", "N", "esc":
+			m.state = Viewing
+			m.table.Focus()
+			m.loading = true
+			return m, fetchServers(m.api, m.metrics)
+		}
+	}
+	return m, nil
+}
+
+// updateHelp handles logic for the help view.
+func updateHelp(msg tea.Msg, m model) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(tea.KeyMsg); ok {
+		m.state = Viewing
+	}
+	return m, nil
+}
+
+// --- VIEW ---
+
+// View renders the TUI to the terminal.
+func (m model) View() string {
+	if m.state == Help {
+		return m.helpView()
+	}
+	if m.state == Picking {
+		return m.picker.View()
+	}
+
+	s := m.headerView()
+
+	switch m.state {
+	case Viewing:
+		s += m.viewingView()
+	case Adding, Editing:
+		s += m.addingEditingView()
+	case Detail:
+		s += m.detailView()
+	case Comparing:
+		s += m.compareView()
+	case RawResponse:
+		s += m.rawView.View() + "\n\n" + m.messageStyle.Render(fmt.Sprintf("Raw /inventory response · %3.f%% · ↑/↓ to scroll, 'Esc' to close", m.rawView.ScrollPercent()*100))
+	case PingAll:
+		s += m.pingView()
+	case BulkStatus:
+		s += m.statusList.View() + "\n\n" + m.messageStyle.Render("Press 'Enter' to choose, 'Esc' to cancel.")
+	case BulkConfirm:
+		s += fmt.Sprintf("Set %d servers to %s?\n", len(m.selectedServers()), m.bulkStatus)
+		for _, server := range m.selectedServers() {
+			s += "\n  " + server.Name + " " + m.messageStyle.Render("("+server.Status+")")
+		}
+		s += "\n\n" + m.messageStyle.Render("Press 'y' to apply, 'n' or 'Esc' to cancel.")
+	case History:
+		s += m.historyView.View() + "\n\n" + m.messageStyle.Render("Observed changes, newest first · ↑/↓ to scroll, 'Esc' to close")
+	case Importing:
+		s += m.textInput.View() + "\n\n" + m.messageStyle.Render("Press 'Enter' to read the file, 'Esc' to cancel.")
+	case ImportConfirm:
+		s += m.importConfirmView()
+	case AddAnother:
+		s += "Add another server? (y/n)\n\n" + m.messageStyle.Render(fmt.Sprintf("Location '%s' and status '%s' will be carried over.", m.lastCreated.Location, m.lastCreated.Status))
+	case SwitchingEnv:
+		s += m.envList.View() + "\n\n" + m.messageStyle.Render("Press 'Enter' to switch, 'Esc' to cancel.")
+	case DeleteChoice:
+		s += m.deleteOptions.View() + "\n\n" + m.messageStyle.Render("Press 'Enter' to choose, 'Esc' to cancel.")
+	case Annotating:
+		s += m.textInput.View() + "\n\n" + m.messageStyle.Render("Press 'Enter' to save (empty clears it), 'Esc' to cancel.")
+	case Touching:
+		s += fmt.Sprintf("Re-send a report for '%s' with its current values?\n\n", m.touchTarget.Name) +
+			m.messageStyle.Render("Press 'y' to send, 'n' or 'Esc' to cancel.")
+	case Deleting:
+		if m.deleteBatch != nil && m.softDelete {
+			s += fmt.Sprintf("You are about to decommission %d servers by setting their status to %s.\n", len(m.deleteBatch), m.config.DecommissionStatus)
+		} else if m.deleteBatch != nil {
+			s += fmt.Sprintf("You are about to delete %d servers. This cannot be undone.\n", len(m.deleteBatch))
+		}
+		if m.deleteBatch != nil {
+			for _, server := range m.deleteBatch {
+				s += "\n  " + server.Name + " " + m.messageStyle.Render("("+server.Status+")")
+			}
+			if m.strictDelete {
+				s += "\n\nType 'yes' to proceed:\n\n" + m.textInput.View() + "\n\n" + m.messageStyle.Render("Press 'Enter' to confirm, 'Esc' to cancel.")
+			} else {
+				s += "\n\n" + m.messageStyle.Render("Press 'y' to confirm, 'n' or 'Esc' to cancel.")
+			}
+		} else if m.strictDelete {
+			s += fmt.Sprintf("'%s' is a production server. Type its name or DELETE to confirm:\n\n", m.deleteTarget) +
+				m.textInput.View() + "\n\n" + m.messageStyle.Render("Press 'Enter' to delete, 'Esc' to cancel.")
+		} else if m.softDelete {
+			s += fmt.Sprintf("Decommission '%s' by setting its status to %s?\n\n", m.deleteTarget, m.config.DecommissionStatus) +
+				m.messageStyle.Render("Press 'y' to confirm, 'n' or 'Esc' to cancel.")
+		} else {
+			s += fmt.Sprintf("Are you sure you want to delete '%s'?\n\n", m.deleteTarget) + m.messageStyle.Render("Press 'y' to confirm, 'n' or 'Esc' to cancel.")
+		}
+	}
+
+	return s
+}
+
+// headerView renders the title and status message shown above every form.
+func (m model) headerView() string {
+	title := "Server Inventory Dashboard"
+	if m.envName != "" {
+		title += " [" + m.envName + "]"
+	}
+	s := m.headerStyle.Render(title) + "\n\n"
+
+	if m.loading {
+		s += m.spinnerStyle.Render("⠋") + " Loading..."
+		if m.retry.attempt > 0 {
+			s += fmt.Sprintf(" (attempt %d/%d)", m.retry.attempt, m.retry.attempts)
+		}
+	} else {
+		s += m.messageView()
+	}
+	return s + "\n\n"
+}
+
+// messageView renders the status message fitted to the window: cut off with
+// an ellipsis, or with wrapMessage on, wrapped over as many lines as it needs.
+func (m model) messageView() string {
+	switch {
+	case m.width == 0:
+		return m.currentMsgStyle.Render(m.message)
+	case m.wrapMessage:
+		return m.currentMsgStyle.Width(m.width).Render(m.message)
+	default:
+		return m.currentMsgStyle.Render(ansi.Truncate(m.message, m.width, "…"))
+	}
+}
+
+// viewingView renders the main table.
+func (m model) viewingView() string {
+	s := m.aboveTableView()
+	if len(m.servers) > 0 && m.compact {
+		s += m.compactView()
+	} else if len(m.servers) > 0 {
+		lines := strings.Split(m.tableView(), "\n")
+		if m.showColumnFilters() && len(lines) >= tableHeaderLines {
+			lines = slices.Insert(lines, tableHeaderLines, m.columnFilterRow())
+		}
+		tableView := m.tableStyle.Render(strings.Join(lines, "\n"))
+		if m.showSummary {
+			tableView = lipgloss.JoinHorizontal(lipgloss.Top, tableView, " ", m.summaryView())
+		}
+		s += tableView
+		if len(m.visible) == 0 {
+			s += "\nNo servers match the current filters."
+		}
+	} else if m.loading {
+		s += m.skeletonView()
+	} else if !m.loadedOnce || m.fetchFailed {
+		// An empty table after a failed fetch says nothing about the inventory.
+		s += "Could not load the inventory. Press 'r' to retry."
+	} else if m.config != nil && m.config.EmptyMessage != "" {
+		s += m.config.EmptyMessage
+	} else {
+		s += defaultConfig().EmptyMessage
+	}
+	s += "\n" + m.statusBarView()
+	if m.showFooter {
+		s += "\n\n" + m.messageStyle.Render("'a' add | 'd' delete | 'e' edit | '/' filter | 's' sort | '?' help | 'q' quit")
+	}
+	return s
+}
+
+// statusBarView renders the one-line bar under the table: connection, counts,
+// filters, sort, polling and display timezone, e.g.
+// "● connected │ 12/40 shown │ filter: loc=fra │ sort: Name ▲ │ every 30s".
+// On narrow terminals the least important pieces are dropped from the end.
+func (m model) statusBarView() string {
+	connection, connectionStyle := "○ not loaded", m.messageStyle
+	switch {
+	case m.loading:
+		connection = "… loading"
+	case m.fetchFailed:
+		connection, connectionStyle = "○ disconnected", m.offlineStyle
+	case m.loadedOnce:
+		connection, connectionStyle = "● connected", m.onlineStyle
+	}
+
+	counts := fmt.Sprintf("%d servers", len(m.servers))
+	if m.filterActive() {
+		counts = fmt.Sprintf("%d/%d shown", len(m.visible), len(m.servers))
+	}
+	if selected := len(m.selectedServers()); selected > 0 {
+		counts += fmt.Sprintf(", %d selected", selected)
+	}
+	parts := []string{connection, counts}
+
+	var filters []string
+	if m.filterQuery != "" {
+		filters = append(filters, fmt.Sprintf("%q", m.filterQuery))
+	}
+	if m.columnFilterActive() {
+		filters = append(filters, "columns")
+	}
+	if m.locationOnly != "" {
+		filters = append(filters, "loc="+m.locationOnly)
+	}
+	if m.staleOnly {
+		filters = append(filters, "stale > "+formatAge(m.staleThreshold()))
+	}
+	if m.pinView == pinsOnly {
+		filters = append(filters, "pinned only")
+	}
+	for _, status := range statuses {
+		if !m.statusVisible(status) {
+			filters = append(filters, "-"+status)
+		}
+	}
+	if len(filters) > 0 {
+		parts = append(parts, "filter: "+strings.Join(filters, " "))
+	}
+
+	var order []string
+	if m.pinView == pinsFirst {
+		order = append(order, "pinned first")
+	}
+	if m.prioritySort {
+		order = append(order, "problems first")
+	}
+	if m.recentFirst() {
+		order = append(order, "newest reports first")
+	} else if m.sortColumn >= 0 {
+		arrow := "▼"
+		if m.sortAsc {
+			arrow = "▲"
+		}
+		order = append(order, columnTitles[m.sortColumn]+" "+arrow)
+	}
+	if len(order) > 0 {
+		parts = append(parts, "sort: "+strings.Join(order, ", "))
+	}
+
+	if m.pollInterval > 0 {
+		parts = append(parts, "every "+m.pollInterval.String())
+	}
+	if m.displayLoc != nil {
+		parts = append(parts, "times in "+m.displayLoc.String())
+	}
+
+	const separator = " │ "
+	for m.width > 0 && len(parts) > 1 && ansi.StringWidth(strings.Join(parts, separator)) > m.width {
+		parts = parts[:len(parts)-1]
+	}
+	if last := len(parts) - 1; m.width > 0 {
+		// The last piece can still be too wide, e.g. a long filter query.
+		used := 0
+		if last > 0 {
+			used = ansi.StringWidth(strings.Join(parts[:last], separator) + separator)
+		}
+		parts[last] = ansi.Truncate(parts[last], max(1, m.width-used), "…")
+	}
+	styled := []string{connectionStyle.Render(parts[0])}
+	for _, part := range parts[1:] {
+		styled = append(styled, m.messageStyle.Render(part))
+	}
+	return strings.Join(styled, m.messageStyle.Render(separator))
+}
+
+// fitTable sizes the table to the rows left over by everything drawn around
+// it, so hiding the footer or a filter bar gives the space back to the table,
+// and scrolls it to keep the cursor in view.
+func (m *model) fitTable() {
+	if m.height == 0 {
+		m.tableOffset = m.tableStart()
+		return // no window size yet
+	}
+	// One more line for the status bar.
+	around := strings.Count(m.headerView()+m.aboveTableView(), "\n") + m.tableStyle.GetVerticalFrameSize() + 1
+	if m.showFooter {
+		around += 2
+	}
+	if m.showColumnFilters() {
+		around++
+	}
+	height := max(tableHeaderLines+1, m.height-around)
+	if height != m.table.Height()+tableHeaderLines {
+		m.table.SetHeight(height)
+	}
+	m.tableOffset = m.tableStart()
+}
+
+// tableStart returns the first row to draw: tableOffset, scrolled just far
+// enough to keep the cursor on screen.
+func (m model) tableStart() int {
+	height := max(1, m.table.Height())
+	cursor := m.table.Cursor()
+	start := m.tableOffset
+	if cursor < start {
+		start = cursor
+	}
+	if cursor >= start+height {
+		start = cursor - height + 1
+	}
+	return max(0, min(start, len(m.visible)-height))
+}
+
+// tableView renders the column headers and the rows currently in view. The
+// table component only tracks the cursor and columns; rows are drawn here so
+// each cell can be styled from the server it shows.
+func (m model) tableView() string {
+	lines := []string{m.tableHeaderView()}
+	rows := m.table.Rows()
+	start := m.tableStart()
+	for i := start; i < start+m.table.Height(); i++ {
+		if i < len(rows) && i < len(m.visible) {
+			lines = append(lines, m.renderRow(rows[i], i))
+		} else {
+			lines = append(lines, "") // keep the table's height fixed
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tableHeaderView renders the column titles and the rule under them.
+func (m model) tableHeaderView() string {
+	var cells []string
+	for _, column := range m.columns() {
+		title := ansi.Truncate(column.Title, column.Width, "…")
+		cells = append(cells, tableHeaderStyle.Render(title+strings.Repeat(" ", max(0, column.Width-ansi.StringWidth(title)))))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, cells...)
+}
+
+// selectedServer returns the server under the table cursor.
+func (m model) selectedServer() (Server, bool) {
+	cursor := m.table.Cursor()
+	if cursor < 0 || cursor >= len(m.visible) {
+		return Server{}, false
+	}
+	return m.visible[cursor], true
+}
+
+// nextUnhealthy finds the next visible server that isn't Online, moving from
+// the cursor in direction step and wrapping around.
+func (m model) nextUnhealthy(step int) (int, bool) {
+	n := len(m.visible)
+	cursor := m.table.Cursor()
+	for k := 1; k <= n; k++ {
+		i := ((cursor+step*k)%n + n) % n
+		if m.visible[i].Status != "Online" {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// selectedServers returns the multi-selected servers in inventory order.
+func (m model) selectedServers() []Server {
+	var servers []Server
+	for _, server := range m.servers {
+		if m.selected[server.Name] {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// locationStat counts a location's servers by status.
+type locationStat struct {
+	location string
+	counts   map[string]int
+	total    int
+}
+
+// locationStats aggregates servers per location, sorted by location name.
+func locationStats(servers []Server) []locationStat {
+	byLocation := map[string]*locationStat{}
+	for _, server := range servers {
+		stat, ok := byLocation[server.Location]
+		if !ok {
+			stat = &locationStat{location: server.Location, counts: map[string]int{}}
+			byLocation[server.Location] = stat
+		}
+		stat.counts[server.Status]++
+		stat.total++
+	}
+	stats := make([]locationStat, 0, len(byLocation))
+	for _, stat := range byLocation {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].location < stats[j].location })
+	return stats
+}
+
+// summaryView renders the per-location panel shown beside the table.
+func (m model) summaryView() string {
+	s := "Locations\n\n"
+	for _, stat := range locationStats(m.servers) {
+		location := stat.location
+		if location == "" {
+			location = "(none)"
+		}
+		others := stat.total - stat.counts["Online"] - stat.counts["Offline"]
+		s += fmt.Sprintf("%-16s %s %s %s\n", ansi.Truncate(location, 16, "…"),
+			m.onlineStyle.Render(fmt.Sprintf("●%-3d", stat.counts["Online"])),
+			m.offlineStyle.Render(fmt.Sprintf("○%-3d", stat.counts["Offline"])),
+			m.otherStyle.Render(fmt.Sprintf("◐%-3d", others)))
+	}
+	return m.tableStyle.Render(strings.TrimSuffix(s, "\n"))
+}
+
+// historyText renders history entries newest first, one line per change.
+func (m model) historyText(entries []historyEntry) string {
+	if len(entries) == 0 {
+		return m.messageStyle.Render("No changes recorded yet.")
+	}
+	var lines []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		at := entry.Time.Local().Format("2006-01-02 15:04:05")
+		if m.displayLoc != nil {
+			at = entry.Time.In(m.displayLoc).Format("2006-01-02 15:04:05 MST")
+		}
+		for _, name := range entry.Added {
+			lines = append(lines, at+"  "+m.onlineStyle.Render("+ "+name))
+		}
+		for _, name := range entry.Removed {
+			lines = append(lines, at+"  "+m.offlineStyle.Render("- "+name))
+		}
+		for _, changed := range entry.Changed {
+			lines = append(lines, at+"  "+m.otherStyle.Render("~ "+changed.Name)+"  "+strings.Join(changed.Changes, "; "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pingView lists every swept server with its result so far.
+func (m model) pingView() string {
+	reachable := 0
+	for _, result := range m.ping.results {
+		if result.err == nil {
+			reachable++
+		}
+	}
+	s := fmt.Sprintf("Reachability on port %d: %d/%d done, %d reachable\n\n",
+		m.config.PingPort, len(m.ping.results), len(m.ping.servers), reachable)
+	for _, server := range m.ping.servers {
+		result, ok := m.ping.results[server.Name]
+		var outcome string
+		switch {
+		case !ok:
+			outcome = m.messageStyle.Render("…")
+		case errors.Is(result.err, errNoValidIP):
+			outcome = m.otherStyle.Render("? no valid IP")
+		case result.err != nil:
+			outcome = m.offlineStyle.Render("✗ unreachable")
+		default:
+			outcome = m.onlineStyle.Render(fmt.Sprintf("✓ %dms", result.latency.Milliseconds()))
+		}
+		s += fmt.Sprintf("%-20s %-18s %s\n", ansi.Truncate(server.Name, 20, "…"), server.IP, outcome)
+	}
+	s = m.helpStyle.Render(strings.TrimSuffix(s, "\n"))
+	if m.ping.done {
+		return s + "\n\n" + m.messageStyle.Render("Press 'Esc' to close.")
+	}
+	return s + "\n\n" + m.messageStyle.Render("Press 'Esc' to cancel.")
+}
+
+// importConfirmView summarizes an import before anything is sent to the API.
+func (m model) importConfirmView() string {
+	plan := m.importPlan
+	s := m.successStyle.Render(fmt.Sprintf("%d new", len(plan.added))) + ", " +
+		m.cancelStyle.Render(fmt.Sprintf("%d already in the inventory", len(plan.duplicates))) + "\n"
+	for _, server := range plan.duplicates {
+		s += "  " + server.Name + "\n"
+	}
+	s += "\n"
+	if len(plan.duplicates) > 0 {
+		return s + m.messageStyle.Render("Press 's' to skip existing servers, 'o' to overwrite them, 'n' or 'Esc' to cancel.")
+	}
+	return s + m.messageStyle.Render("Press 's' to import, 'n' or 'Esc' to cancel.")
+}
+
+// skeletonView renders greyed-out placeholder rows while the first load is in flight.
+func (m model) skeletonView() string {
+	rows := make([]string, 5)
+	for i := range rows {
+		for _, width := range m.widths() {
+			// Vary the bar lengths a little so it reads as data, not a border.
+			bar := width * (2 + i%2) / 4
+			rows[i] += " " + strings.Repeat("░", bar) + strings.Repeat(" ", width-bar) + " "
+		}
+	}
+	return m.tableStyle.Render(m.otherStyle.Render("Loading inventory...") + "\n\n" +
+		m.otherStyle.Faint(true).Render(strings.Join(rows, "\n")))
+}
+
+// aboveTableView renders the bars shown between the message line and the table.
+// Each line ends in a newline so tableHeaderY can count them.
+func (m model) aboveTableView() string {
+	s := m.statusFilterView() + "\n"
+	if m.resizing {
+		s += m.resizeView() + "\n"
+	}
+	if m.filtering {
+		s += "Filter: " + m.filterInput.View() + "\n"
+	} else if m.filterQuery != "" {
+		s += m.messageStyle.Render(fmt.Sprintf("Filter: %s ('/' to edit, 'Esc' to clear)", m.filterQuery)) + "\n"
+	}
+	if m.filterErr != "" {
+		s += m.cancelStyle.Render("Invalid filter: "+m.filterErr+" (showing the last valid filter)") + "\n"
+	}
+	if m.locationOnly != "" {
+		s += m.messageStyle.Render(fmt.Sprintf("Location: %s ('l' or 'Esc' to clear)", m.locationOnly)) + "\n"
+	}
+	return s
+}
+
+// resizeView renders the hint line shown while adjusting column widths.
+func (m model) resizeView() string {
+	return m.messageStyle.Render(fmt.Sprintf("Resizing %s (%d): tab/shift+tab to pick a column, +/- to resize, 'Esc' when done",
+		columnTitles[m.resizeColumn], m.columnWidths[m.resizeColumn]))
+}
+
+// statusFilterView renders the status toggles with their counts, e.g.
+// "[1] ● Online (12)  [2] ○ Offline (3)".
+func (m model) statusFilterView() string {
+	counts := m.summaryCounts
+	if counts == nil {
+		counts = map[string]int{}
+		for _, server := range m.servers {
+			counts[server.Status]++
+		}
+	}
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		mark := "○"
+		if m.statusFilter[status] {
+			mark = "●"
+		}
+		parts[i] = fmt.Sprintf("[%d] %s %s (%d)", i+1, mark, status, counts[status])
+	}
+	return m.messageStyle.Render("Show: " + strings.Join(parts, "  "))
+}
+
+// statusVisible reports whether the status filter bar lets a server through.
+// Statuses outside the known set are always shown.
+func (m model) statusVisible(status string) bool {
+	shown, known := m.statusFilter[status]
+	return shown || !known
+}
+
+// filterActive reports whether any filter is hiding servers from the table.
+func (m model) filterActive() bool {
+	if m.filterQuery != "" || m.locationOnly != "" || m.staleOnly || m.pinView == pinsOnly || m.columnFilterActive() {
+		return true
+	}
+	for _, shown := range m.statusFilter {
+		if !shown {
+			return true
+		}
+	}
+	return false
+}
+
+// columnFilterActive reports whether any per-column filter has text.
+func (m model) columnFilterActive() bool {
+	for _, input := range m.columnFilters {
+		if strings.TrimSpace(input.Value()) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesColumnFilters reports whether every non-empty per-column filter is a
+// case-insensitive substring of that column's value.
+func (m model) matchesColumnFilters(server Server) bool {
+	values := []string{server.Name, server.IP, server.Location, server.Status, m.formatReport(server.LastReport)}
+	for i, input := range m.columnFilters {
+		query := strings.ToLower(strings.TrimSpace(input.Value()))
+		if query != "" && !strings.Contains(strings.ToLower(values[i]), query) {
+			return false
+		}
+	}
+	return true
+}
+
+// columnFilterRow renders the per-column filter inputs aligned under the
+// column headers, padded the way the table pads its cells.
+func (m model) columnFilterRow() string {
+	var b strings.Builder
+	for i, column := range m.table.Columns() {
+		input := m.columnFilters[i]
+		view := input.Value()
+		if m.columnFiltering && i == m.columnFocus {
+			view = input.View()
+		} else if view == "" {
+			view = m.messageStyle.Render("·")
+		}
+		view = ansi.Truncate(view, column.Width, "…")
+		b.WriteString(" " + view + strings.Repeat(" ", max(0, column.Width-ansi.StringWidth(view))) + " ")
+	}
+	return b.String()
+}
+
+// showColumnFilters reports whether the per-column filter row is drawn.
+func (m model) showColumnFilters() bool {
+	return m.columnFiltering || m.columnFilterActive()
+}
+
+// filterExpr is a parsed filter query: any of its clauses must match, and a
+// clause matches when all of its terms do. The empty expression matches all.
+type filterExpr [][]filterTerm
+
+// filterTerm is one term of a filter query, lower-cased and with its field
+// prefix split off. glob is set when the text has * or ?.
+type filterTerm struct {
+	field string // "name", "ip", "loc" or "status"; empty searches every field
+	text  string
+	glob  *regexp.Regexp
+}
+
+// parseFilter splits a filter query on the AND and OR keywords, with AND
+// binding tighter, e.g. "status:offline AND loc:eu-* OR name:db" is
+// (status:offline AND loc:eu-*) OR name:db. The keywords are only recognised
+// in upper case so plain searches for "and" or "or" keep working.
+func parseFilter(query string) (filterExpr, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	var expr filterExpr
+	var clause []filterTerm
+	var term []string
+	for i, word := range words {
+		if word != "AND" && word != "OR" {
+			term = append(term, word)
+			continue
+		}
+		if len(term) == 0 {
+			return nil, fmt.Errorf("%s at word %d has nothing before it", word, i+1)
+		}
+		clause = append(clause, parseTerm(strings.Join(term, " ")))
+		term = nil
+		if word == "OR" {
+			expr = append(expr, clause)
+			clause = nil
+		}
+	}
+	if len(term) == 0 {
+		return nil, fmt.Errorf("%s has nothing after it", words[len(words)-1])
+	}
+	return append(expr, append(clause, parseTerm(strings.Join(term, " ")))), nil
+}
+
+// matches reports whether a server satisfies the expression.
+func (e filterExpr) matches(server Server) bool {
+	if len(e) == 0 {
+		return true
+	}
+	for _, clause := range e {
+		if !slices.ContainsFunc(clause, func(term filterTerm) bool { return !term.matches(server) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTerm reads a single filter term. A "name:", "ip:", "loc:" or
+// "status:" prefix scopes the match to that field; otherwise every field is
+// searched. Matching is a case-insensitive substring, or with * or ? in the
+// term, a glob over the whole field, e.g. "loc:eu-*".
+func parseTerm(query string) filterTerm {
+	term := filterTerm{text: strings.ToLower(strings.TrimSpace(query))}
+	if field, value, ok := strings.Cut(term.text, ":"); ok {
+		switch field {
+		case "name", "ip", "loc", "status":
+			term.field, term.text = field, strings.TrimSpace(value)
+		case "location":
+			term.field, term.text = "loc", strings.TrimSpace(value)
+		}
+		// Anything else (e.g. an IPv6 address) searches for the whole query.
+	}
+	if strings.ContainsAny(term.text, "*?") {
+		term.glob = globPattern(term.text)
+	}
+	return term
+}
+
+// matches reports whether a server matches the term.
+func (t filterTerm) matches(server Server) bool {
+	if t.text == "" {
+		return true
+	}
+	contains := func(field string) bool {
+		field = strings.ToLower(field)
+		if t.glob != nil {
+			return t.glob.MatchString(field)
+		}
+		return strings.Contains(field, t.text)
+	}
+	switch t.field {
+	case "name":
+		return contains(server.Name)
+	case "ip":
+		return contains(server.IP)
+	case "loc":
+		return contains(server.Location)
+	case "status":
+		return contains(server.Status)
+	}
+	return contains(server.Name) || contains(server.IP) || contains(server.Location) || contains(server.Status)
+}
+
+// globPattern compiles a glob that must match a whole value, where * matches
+// any run of characters (including none) and ? matches exactly one.
+func globPattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// tableHeaderLines is the number of lines the table header and its border occupy.
+const tableHeaderLines = 2
+
+// parseServices splits a list of services separated by commas, semicolons or spaces.
+func parseServices(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' '
+	})
+}
+
+// invalidServices returns the entries that look like name:port but whose port
+// isn't a number from 1 to 65535. Entries without a port are accepted.
+func invalidServices(services []string) []string {
+	var bad []string
+	for _, service := range services {
+		name, port, ok := strings.Cut(service, ":")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(port); name == "" || err != nil || n < 1 || n > 65535 {
+			bad = append(bad, service)
+		}
+	}
+	return bad
+}
+
+// validIP reports whether value parses as an IPv4 or IPv6 address.
+func validIP(value string) bool {
+	return net.ParseIP(value) != nil
+}
+
+// compactView renders one colored line per server without the table's
+// borders and padding, in the space the table would take. The table still
+// owns the cursor, so navigation works the same.
+func (m model) compactView() string {
+	if len(m.visible) == 0 {
+		return "No servers match the current filters."
+	}
+	rows := m.table.Height() + tableHeaderLines + m.tableStyle.GetVerticalFrameSize()
+	cursor := m.table.Cursor()
+	start := max(0, min(cursor-rows/2, len(m.visible)-rows))
+	end := min(len(m.visible), start+rows)
+	now := time.Now()
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		server := m.visible[i]
+		age := "—"
+		if d, ok := reportAge(server, now); ok {
+			age = formatAge(d) + " ago"
+		}
+		status := m.statusStyle(server.Status).Render(fmt.Sprintf("%-12s", server.Status))
+		rest := fmt.Sprintf("%-22s %-16s %-14s %s", m.displayName(server), m.displayIP(server.IP), server.Location, age)
+		if note := m.annotations[server.Name]; note != "" {
+			rest += " " + m.annotationStyle.Render("⚑ "+note)
+		}
+		if i == cursor {
+			status, rest = selectedRowStyle.Render(ansi.Strip(status)), selectedRowStyle.Render(rest)
+		}
+		lines = append(lines, status+rest)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderRow draws the cells of m.visible[index] with the table's padding.
+// Each cell gets its cellStyle on top of the row's rowStyle.
+func (m model) renderRow(cells table.Row, index int) string {
+	server := m.visible[index]
+	row := m.rowStyle(server, index)
+	var b strings.Builder
+	// The leading padding space doubles as a marker slot so widths don't change.
+	switch {
+	case m.selected[server.Name]:
+		b.WriteString(m.successStyle.Inherit(row).Render("✓"))
+	case m.recentlyChanged(server.Name):
+		b.WriteString(m.changedStyle.Inherit(row).Render("●"))
+	default:
+		b.WriteString(row.Render(" "))
+	}
+	for col, width := range m.widths() {
+		style := row
+		if server.Name != m.flashRow {
+			style = m.cellStyle(server, col).Inherit(row)
+		}
+		cell := cells[col]
+		b.WriteString(style.Render(cell + strings.Repeat(" ", max(0, width-ansi.StringWidth(cell)))))
+		if col < len(columnTitles)-1 {
+			b.WriteString(row.Render("  ")) // padding between cells
+		}
+	}
+	b.WriteString(row.Render(" "))
+	return b.String()
+}
+
+// rowStyle is the base style of a row. In order of precedence: the refresh
+// flash, the cursor, the status tint when colorWholeRow is on, zebra striping.
+func (m model) rowStyle(server Server, index int) lipgloss.Style {
+	switch {
+	case server.Name == m.flashRow:
+		return m.flashStyle
+	case index == m.table.Cursor():
+		return selectedRowStyle
+	case m.config != nil && m.config.ColorWholeRow && server.Status != "Online":
+		if server.Status == "Offline" {
+			return lipgloss.NewStyle().Background(lipgloss.Color("52"))
+		}
+		return lipgloss.NewStyle().Background(lipgloss.Color("58"))
+	case index%2 == 1 && m.altRowColor() != "":
+		return lipgloss.NewStyle().Background(lipgloss.Color(m.altRowColor()))
+	}
+	return lipgloss.NewStyle()
+}
+
+// altRowColor is the background of alternate rows, empty for none.
+func (m model) altRowColor() string {
+	if m.config == nil {
+		return defaultConfig().AltRowColor
+	}
+	return m.config.AltRowColor
+}
+
+// cellStyle returns the style of one cell; anything it leaves unset comes from the row.
+func (m model) cellStyle(server Server, col int) lipgloss.Style {
+	switch col {
+	case 0:
+		if m.annotations[server.Name] != "" {
+			return m.annotationStyle
+		}
+	case 1:
+		if !validIP(server.IP) {
+			return m.offlineStyle
+		}
+	case 3:
+		return m.statusStyle(server.Status)
+	}
+	return lipgloss.NewStyle()
+}
+
+// statusStyle returns the color used for a status.
+func (m model) statusStyle(status string) lipgloss.Style {
+	switch status {
+	case "Online":
+		return m.onlineStyle
+	case "Offline":
+		return m.offlineStyle
+	}
+	return m.otherStyle
+}
+
+// recentlyChanged reports whether a server's status changed within changeHighlightTTL.
+func (m model) recentlyChanged(name string) bool {
+	at, ok := m.changedAt[name]
+	return ok && time.Since(at) < changeHighlightTTL
+}
+
+// detailField is one labelled line of the server detail view.
+type detailField struct{ label, value string }
+
+// detailFields lists every field of a server for display, in a fixed order.
+func (m model) detailFields(server Server) []detailField {
+	return []detailField{
+		{"Name", server.Name},
+		{"IP", server.IP},
+		{"Location", server.Location},
+		{"Status", statusWithAge(server, time.Now())},
+		{"Services", strings.Join(server.Services, ", ")},
+		{"Tags", strings.Join(server.Tags, ", ")},
+		{"Last Report", m.formatReport(server.LastReport)},
+		{"Modified By", server.ModifiedBy},
+		{"Modified At", m.formatReport(server.ModifiedAt)},
+		{"Maintenance", m.maintenanceDetail(server, time.Now())},
+		{"Note", m.annotationDetail(server.Name)},
+	}
+}
+
+// ipList returns the servers' IPs one per line, skipping empty ones, and how
+// many there were. A non-empty group adds an ini-style [group] header as used
+// by Ansible inventories.
+func ipList(servers []Server, group string) (string, int) {
+	var lines []string
+	if group != "" {
+		lines = append(lines, "["+group+"]")
+	}
+	count := 0
+	for _, server := range servers {
+		if server.IP != "" {
+			lines = append(lines, server.IP)
+			count++
+		}
+	}
+	return strings.Join(lines, "\n") + "\n", count
+}
+
+// curlCommand returns a shell command that sends the same report request the
+// tool sends when saving server. The token is left as $WOLF_INV_TOKEN unless
+// curlShowToken is set, in which case it is read the way requests read it.
+func (m model) curlCommand(server Server) (string, error) {
+	body, _ := json.Marshal(editableFields(server))
+	auth := shellQuote("Authorization: Bearer ") + `"$WOLF_INV_TOKEN"`
+	if m.config.CurlShowToken {
+		token, err := currentToken(m.apiToken, m.config.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		auth = shellQuote("Authorization: Bearer " + token)
+	}
+	userAgent := m.config.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	return strings.Join([]string{
+		"curl -X PUT " + shellQuote(endpoint(m.apiBaseURL, m.config.ReportPath)),
+		"-H " + shellQuote("Content-Type: application/json"),
+		"-H " + auth,
+		"-H " + shellQuote("User-Agent: "+userAgent),
+		"--data " + shellQuote(string(body)),
+	}, " \\\n  "), nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// markdownSnippet formats a server as a markdown table of its detail fields.
+func (m model) markdownSnippet(server Server) string {
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	s := "### " + escape.Replace(server.Name) + "\n\n| Field | Value |\n|---|---|\n"
+	for _, field := range m.detailFields(server) {
+		value := field.value
+		if value == "" {
+			value = "—"
+		}
+		s += "| " + field.label + " | " + escape.Replace(value) + " |\n"
+	}
+	return s
+}
+
+// detailView renders all fields of the selected server.
+func (m model) detailView() string {
+	server, ok := m.selectedServer()
+	if !ok {
+		return ""
+	}
+	s := ""
+	for _, field := range m.detailFields(server) {
+		value := field.value
+		if value == "" {
+			value = m.messageStyle.Render("—")
+		} else if style, ok := m.detailStyle(server, field.label); ok {
+			value = style.Render(value)
+		}
+		s += fmt.Sprintf("%-12s %s\n", field.label+":", value)
+	}
+	s = m.helpStyle.Render(strings.TrimSuffix(s, "\n"))
+	return s + "\n\n" + m.messageStyle.Render("Press 'Esc' or 'Enter' to return.")
+}
+
+// detailStyle returns the highlight for a detail field that needs attention:
+// a local note, or a maintenance window that has run out. detailFields itself
+// stays plain so its values can be copied elsewhere.
+func (m model) detailStyle(server Server, label string) (lipgloss.Style, bool) {
+	switch label {
+	case "Note":
+		return m.annotationStyle, true
+	case "Maintenance":
+		if badge, ok := maintenanceCountdown(server, time.Now()); ok && badge == "overdue" {
+			return m.offlineStyle, true
+		}
+	}
+	return lipgloss.Style{}, false
+}
+
+// compareView renders the compare base and another server side by side in
+// the detail view's format, highlighting the fields that differ.
+func (m model) compareView() string {
+	left := m.detailFields(m.comparePair[0])
+	right := m.detailFields(m.comparePair[1])
+	labelWidth := 0
+	for _, field := range left {
+		labelWidth = max(labelWidth, len(field.label)+1)
+	}
+	// Split what's left of the window between the two sides, leaving room for
+	// the panel's border and padding.
+	valueWidth := 40
+	if m.width > 0 {
+		valueWidth = max(10, (m.width-labelWidth-m.helpStyle.GetHorizontalFrameSize()-4)/2)
+	}
+	cell := func(value string) string {
+		if value == "" {
+			value = m.messageStyle.Render("—")
+		}
+		value = ansi.Truncate(value, valueWidth, "…")
+		return value + strings.Repeat(" ", max(0, valueWidth-ansi.StringWidth(value)))
+	}
+	s := ""
+	differences := 0
+	for i := range left {
+		label := fmt.Sprintf("%-*s", labelWidth, left[i].label+":")
+		a, b := left[i].value, right[i].value
+		// Names always differ, so only the other fields count as drift.
+		if i > 0 && a != b {
+			differences++
+			highlight := m.cancelStyle.Bold(true)
+			label, a, b = highlight.Render(label), highlight.Render(a), highlight.Render(b)
+		}
+		s += label + "  " + cell(a) + "  " + cell(b) + "\n"
+	}
+	summary := fmt.Sprintf("%d of %d fields differ.", differences, len(left)-1)
+	if differences == 0 {
+		summary = "No differences."
+	}
+	s = m.helpStyle.Render(strings.TrimSuffix(s, "\n"))
+	return s + "\n\n" + m.messageStyle.Render(summary+" Press 'Esc' or 'Enter' to return.")
+}
+
+// addingEditingView renders the form for adding or editing a server.
+func (m model) addingEditingView() string {
+	s := ""
+	switch m.addingState {
+	case InputName, InputIP, InputLocation, InputServices:
+		s += fmt.Sprintf("Enter %s:\n\n%s", m.textInput.Placeholder, m.textInput.View())
+		if m.addingState == InputIP {
+			if m.ipValid {
+				s += " " + m.onlineStyle.Render("✓")
+			} else {
+				s += " " + m.offlineStyle.Render("✗ not a valid IP")
+			}
+		}
+		if m.addingState == InputServices {
+			if bad := invalidServices(parseServices(m.textInput.Value())); len(bad) > 0 {
+				s += " " + m.offlineStyle.Render("✗ expected name:port: "+strings.Join(bad, ", "))
+			}
+			s += "\n" + m.messageStyle.Render("Comma-separated, e.g. ssh:22, https:443. Leave empty for none.")
+		}
+		s += "\n\n" + m.messageStyle.Render("Press 'Enter' to confirm, 'Esc' to cancel.")
+	case InputStatus:
+		s += fmt.Sprintf("Select a Status:\n\n%s", m.statusList.View())
+		s += "\n\n" + m.messageStyle.Render("Press 'Enter' to confirm, 'Esc' to cancel.")
+	case Confirm:
+		if m.staleOnlineWarning() {
+			s += m.cancelStyle.Render(fmt.Sprintf("⚠ This server last reported more than %s ago; marking it Online may not match reality.", formatAge(m.staleThreshold()))) + "\n\n"
+			if m.staleConfirmed {
+				s += m.cancelStyle.Render("Press 'y' again to submit anyway.") + "\n\n"
+			}
+		}
+		if m.state == Editing {
+			changes := serverChanges(m.originalServer, m.currentServer)
+			if len(changes) == 0 {
+				s += "No changes — submit anyway?"
+			} else {
+				s += "Confirm changes?\n"
+				for _, change := range changes {
+					s += "\n  " + m.otherStyle.Render(change)
+				}
+			}
+			s += "\n\n" + m.messageStyle.Render("Press 'y' to submit, 'n' or 'Esc' to cancel.")
+			break
+		}
+		s += fmt.Sprintf("Confirm entry?\n\n  Name:     %s\n  IP:       %s\n  Location: %s\n  Status:   %s",
+			m.currentServer.Name, m.currentServer.IP, m.currentServer.Location, m.currentServer.Status)
+		s += "\n\n" + m.messageStyle.Render("Press 'y' to submit, 'n' or 'Esc' to cancel.")
+	}
 	return s
 }
 
-// viewingView renders the main table.
-func (m model) viewingView() string {
-	s := ""
-	if len(m.servers) > 0 {
-		tableView := m.table.View()
-		lines := strings.Split(tableView, "\n")
-		selectedRowIndex := m.table.Cursor()
-		serverIndex := 0
-
-		for i, line := range lines {
-			if !strings.Contains(line, "│") || strings.Contains(line, "Name") || strings.Contains(line, "─") {
-				continue
-			}
-			if serverIndex < len(m.servers) {
-				server := m.servers[serverIndex]
-				var statusStyle lipgloss.Style
-				switch server.Status {
-				case "Online":
-					statusStyle = m.onlineStyle
-				case "Offline":
-					statusStyle = m.offlineStyle
-				default:
-					statusStyle = m.otherStyle
-				}
-				paddedStatus := server.Status
-				if len(paddedStatus) < 12 {
-					paddedStatus = paddedStatus + strings.Repeat(" ", 12-len(paddedStatus))
+// serverChanges lists the editable fields that differ between two servers, as
+// "Field: old → new" with the field names padded to line up.
+func serverChanges(old, updated Server) []string {
+	var changes []string
+	for _, change := range fieldChanges(old, updated) {
+		changes = append(changes, fmt.Sprintf("%-9s %s → %s", change.field+":", change.from, change.to))
+	}
+	return changes
+}
+
+// fieldChange is one editable field that differs between two servers.
+type fieldChange struct {
+	field, from, to string
+}
+
+// fieldChanges lists the editable fields that differ between two servers.
+func fieldChanges(old, updated Server) []fieldChange {
+	var changes []fieldChange
+	diff := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, fieldChange{field, a, b})
+		}
+	}
+	diff("Name", old.Name, updated.Name)
+	diff("IP", old.IP, updated.IP)
+	diff("Location", old.Location, updated.Location)
+	diff("Status", old.Status, updated.Status)
+	diff("Services", strings.Join(old.Services, ", "), strings.Join(updated.Services, ", "))
+	return changes
+}
+
+// helpView renders the help screen.
+func (m model) helpView() string {
+	return m.helpStyle.Render(
+		"--- Help ---\n\n" +
+			"  a: Add a new server\n" +
+			"  enter: Show details of selected server\n" +
+			"  e: Edit selected server\n" +
+			"  d: Delete selected server (or all multi-selected servers)\n" +
+			"  ctrl+p: Pick a server by name from a fullscreen fuzzy list\n" +
+			"  H: Re-send the selected server's report unchanged (touch)\n" +
+			"  A: Add a local note to the selected server (never sent to the API)\n" +
+			"  ctrl+x: Clear the selected server's note\n" +
+			"  .: Repeat the last add, edit or delete\n" +
+			"  r: Refresh server list\n" +
+			"  R: Refresh selected server only\n" +
+			"  1/2/3: Show or hide Online/Offline/Maintenance servers\n" +
+			"  Y: Copy the IPs of all visible servers (ctrl+y as an ini group)\n" +
+			"  C: Copy the selected server as markdown\n" +
+			"  x/X: Export servers as CSV/JSON (only the filtered ones if filtering)\n" +
+			"  ctrl+s: Save the table as shown to a text file and a CSV\n" +
+			"  I: Import servers from a CSV file\n" +
+			"  /: Filter servers (Esc clears). Scope to one field with\n" +
+			"     name:, ip:, loc: or status:, e.g. 'ip:10.0.' or 'loc:frankfurt'.\n" +
+			"     * and ? match globs over the whole field, e.g. 'loc:eu-*', and\n" +
+			"     AND/OR combine terms (AND binds tighter), e.g.\n" +
+			"     'status:offline AND loc:eu-* OR name:db'\n" +
+			"  l: Show only servers in the selected server's location (again to clear)\n" +
+			"  ctrl+f: Filter by column (tab between columns, Esc clears)\n" +
+			"  U: Copy a curl command that reports the selected server\n" +
+			"  c: Copy an SSH command for the selected server\n" +
+			"  o: Open selected server's web UI\n" +
+			"  s: Cycle sort column (click a header to sort by it)\n" +
+			"  S: Reverse sort direction\n" +
+			"  n/N: Jump to the next/previous server that isn't Online\n" +
+			"  P: Check TCP reachability of every visible server\n" +
+			"  =: Mark the selected server as the compare base (again to clear)\n" +
+			"  D: Compare the selected server side by side with the base\n" +
+			"  Z: Show report times in UTC or local time\n" +
+			"  z: Reset the view: clear filters and sorting, back to the top\n" +
+			"  t: Sort by most recently reported (again to reset)\n" +
+			"  h: Show inventory changes observed across sessions\n" +
+			"  ctrl+t: Change the poll interval (+ to double, - to halve)\n" +
+			"  W: Adjust column widths (tab to pick a column, +/- to resize)\n" +
+			"  w: Wrap long messages instead of cutting them off\n" +
+			"  space: Select or unselect the current server (Esc clears)\n" +
+			"  B: Set the status of all selected servers\n" +
+			"  *: Pin or unpin the selected server\n" +
+			"  f: Cycle pinned servers: inline, first, only\n" +
+			"  ctrl+l: Reload the config file\n" +
+			"  ctrl+e: Edit the config file in $EDITOR, then reload it\n" +
+			"  6: Abbreviate IPv6 addresses in the table\n" +
+			"  V: Toggle the compact one-line-per-server view\n" +
+			"  T: Show only servers with stale reports\n" +
+			"  F: Show or hide the key hint footer\n" +
+			"  L: Toggle the per-location summary panel\n" +
+			"  ctrl+r: Show the raw API response from the last refresh\n" +
+			"  i: Toggle status icons (● Online ○ Offline ◐ Maintenance)\n" +
+			"  p: Toggle priority sort (servers not Online first)\n" +
+			"  E: Switch environment\n" +
+			"  M: Mark all status changes (●) as seen\n" +
+			"  PgUp/PgDn, ctrl+u/ctrl+d: Scroll a page\n" +
+			"  ?: Show this help menu\n" +
+			"  m<key>/'<key>: Set a mark on the selected server / jump to it\n" +
+			"  q: Quit the application\n\n" +
+			m.marksHelp() +
+			"Press any key to return to the main view.\n\n" +
+			m.messageStyle.Render("wolf-inv "+versionString()),
+	)
+}
+
+// marksHelp lists the marks set with m for the help view.
+func (m model) marksHelp() string {
+	if len(m.marks) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(m.marks))
+	for key := range m.marks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s := "Marks:\n"
+	for _, key := range keys {
+		s += fmt.Sprintf("  '%s: %s\n", key, m.marks[key])
+	}
+	return s + "\n"
+}
+
+// --- UTILITIES ---
+
+// columnTitles and columnWidths describe the table columns in display order.
+var (
+	columnTitles = []string{"Name", "IP Address", "Location", "Status", "Last Report"}
+	columnWidths = []int{20, 18, 18, 12, 35}
+	// columnRightAlign marks columns whose contents are padded to the right edge.
+	columnRightAlign = []bool{false, true, false, false, true}
+)
+
+// fitCell truncates value to width with an ellipsis. The table would do this
+// itself, but measuring with ansi widths here keeps wide characters from
+// pushing later cells out of place.
+func fitCell(value string, width int) string {
+	return ansi.Truncate(value, width, "…")
+}
+
+// alignCell right-aligns value within width for right-aligned columns. The
+// table pads and truncates cells itself, so only values that fit are padded.
+func alignCell(col int, value string, width int) string {
+	if !columnRightAlign[col] {
+		return value
+	}
+	if pad := width - ansi.StringWidth(value); pad > 0 {
+		return strings.Repeat(" ", pad) + value
+	}
+	return value
+}
+
+// lastReportColumn is the index of the Last Report column.
+const lastReportColumn = 4
+
+// recentFirst reports whether the table is sorted by newest report first.
+func (m model) recentFirst() bool {
+	return m.sortColumn == lastReportColumn && !m.sortAsc
+}
+
+// minColumnWidth and maxColumnWidth bound the column widths set with 'W'.
+const (
+	minColumnWidth = 4
+	maxColumnWidth = 80
+)
+
+// iconColumnWidth is the Status column width when statuses are shown as icons.
+const iconColumnWidth = 6
+
+// widths returns the current column widths, narrowing Status in icon mode.
+func (m model) widths() []int {
+	widths := append([]int(nil), columnWidths...)
+	if m.columnWidths != nil {
+		copy(widths, m.columnWidths)
+	}
+	if m.iconMode {
+		widths[3] = iconColumnWidth
+	}
+	// Widen Status to fit maintenance countdowns, e.g. "Maintenance 1h20m".
+	widths[3] = max(widths[3], m.statusWidth)
+	return widths
+}
+
+// statusIcon returns the compact symbol for a status.
+func statusIcon(status string) string {
+	switch status {
+	case "Online":
+		return "●"
+	case "Offline":
+		return "○"
+	case "Maintenance":
+		return "◐"
+	}
+	return "?"
+}
+
+// columns builds the table columns, marking the active sort column with an arrow.
+func (m model) columns() []table.Column {
+	columns := make([]table.Column, len(columnTitles))
+	for i, title := range columnTitles {
+		if m.resizing && i == m.resizeColumn {
+			title = "‹" + title + "›"
+		}
+		if i == m.sortColumn {
+			if m.sortAsc {
+				title += " ▲"
+			} else {
+				title += " ▼"
+			}
+		}
+		columns[i] = table.Column{Title: alignCell(i, title, m.widths()[i]), Width: m.widths()[i]}
+	}
+	return columns
+}
+
+// tableHeaderY returns the screen row of the table's column headers in the viewing state.
+func (m model) tableHeaderY() int {
+	return strings.Count(m.headerView()+m.aboveTableView(), "\n") + m.tableStyle.GetBorderTopSize() + m.tableStyle.GetPaddingTop()
+}
+
+// columnAt maps a screen X coordinate to a column index, or -1 if it falls outside the headers.
+func (m model) columnAt(x int) int {
+	x -= m.tableStyle.GetBorderLeftSize() + m.tableStyle.GetPaddingLeft()
+	if x < 0 {
+		return -1
+	}
+	// Each header cell is padded by one space on either side.
+	for i, width := range m.widths() {
+		x -= width + 2
+		if x < 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// pageSize returns how many rows a page-up/page-down jump moves the cursor.
+func (m model) pageSize() int {
+	return max(1, min(m.table.Height(), len(m.visible)))
+}
+
+// sortServers orders servers in place by the given column, keeping API order
+// for ties. In priority mode servers that aren't Online come first, and the
+// column sort applies within each group.
+func sortServers(servers []Server, col int, asc, priority bool) {
+	sort.SliceStable(servers, func(i, j int) bool {
+		if priority {
+			problemI, problemJ := servers[i].Status != "Online", servers[j].Status != "Online"
+			if problemI != problemJ {
+				return problemI
+			}
+		}
+		c := compareServers(servers[i], servers[j], col)
+		if asc {
+			return c < 0
+		}
+		return c > 0
+	})
+}
+
+// compareServers compares two servers by a single column.
+func compareServers(a, b Server, col int) int {
+	switch col {
+	case 0:
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case 1:
+		// Compare parsed addresses so 10.0.0.9 sorts before 10.0.0.10.
+		ipA, ipB := net.ParseIP(a.IP), net.ParseIP(b.IP)
+		if ipA != nil && ipB != nil {
+			return bytes.Compare(ipA.To16(), ipB.To16())
+		}
+		return strings.Compare(a.IP, b.IP)
+	case 2:
+		return strings.Compare(strings.ToLower(a.Location), strings.ToLower(b.Location))
+	case 3:
+		return strings.Compare(a.Status, b.Status)
+	case 4:
+		// Unparseable timestamps count as oldest, so newest-first leaves them at the bottom.
+		timeA, okA := parseReportTime(a.LastReport)
+		timeB, okB := parseReportTime(b.LastReport)
+		if okA || okB {
+			return timeA.Compare(timeB)
+		}
+		return strings.Compare(a.LastReport, b.LastReport)
+	}
+	return 0
+}
+
+// pinView is how pinned servers are presented in the table.
+type pinView int
+
+const (
+	pinsInline pinView = iota // pinned servers stay in place, marked with a star
+	pinsFirst                 // pinned servers float to the top
+	pinsOnly                  // only pinned servers are shown
+)
+
+// shown reports whether server passes every active filter.
+func (m model) shown(server Server, now time.Time) bool {
+	return m.statusVisible(server.Status) &&
+		m.filter.matches(server) &&
+		m.matchesColumnFilters(server) &&
+		(m.locationOnly == "" || strings.EqualFold(server.Location, m.locationOnly)) &&
+		(!m.staleOnly || m.isStale(server, now)) &&
+		(m.pinView != pinsOnly || m.pinned[server.Name])
+}
+
+// displayName is the Name cell of a server, starred when it is pinned and
+// flagged when it has a local note.
+func (m model) displayName(server Server) string {
+	name := server.Name
+	if m.annotations[server.Name] != "" {
+		name = "⚑ " + name
+	}
+	if m.pinned[server.Name] {
+		return "★ " + name
+	}
+	return name
+}
+
+// displayIP is the IP cell of a server: the address as stored, or with
+// shortIPv6 on, an IPv6 address cut down to its last two groups.
+func (m model) displayIP(value string) string {
+	if !m.shortIPv6 {
+		return value
+	}
+	return abbreviateIPv6(value)
+}
+
+// abbreviateIPv6 shortens an IPv6 address to "…" and its last two groups, e.g.
+// 2001:db8:85a3::8a2e:370:7334 becomes …:370:7334. Anything else, IPv4
+// included, is returned unchanged.
+func abbreviateIPv6(value string) string {
+	ip := net.ParseIP(value)
+	if ip == nil || ip.To4() != nil {
+		return value
+	}
+	short := fmt.Sprintf("…:%x:%x", uint16(ip[12])<<8|uint16(ip[13]), uint16(ip[14])<<8|uint16(ip[15]))
+	if canonical := ip.String(); len(canonical) <= len(short) {
+		return canonical
+	}
+	return short
+}
+
+// pinnedNames returns the pinned server names in sorted order.
+func (m model) pinnedNames() []string {
+	names := make([]string, 0, len(m.pinned))
+	for name := range m.pinned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// updateTable updates the table model with new server data.
+func (m *model) updateTable() {
+	// Keep the cursor on the same server when rows come and go or reorder.
+	selected, hadSelection := m.selectedServer()
+	now := time.Now()
+	// A query that doesn't parse leaves the last good one in place.
+	if filter, err := parseFilter(m.filterQuery); err != nil {
+		m.filterErr = err.Error()
+	} else {
+		m.filter, m.filterErr = filter, ""
+	}
+	m.visible = nil
+	for _, server := range m.servers {
+		if m.shown(server, now) {
+			m.visible = append(m.visible, server)
+		}
+	}
+	if m.sortColumn >= 0 || m.prioritySort {
+		sortServers(m.visible, m.sortColumn, m.sortAsc, m.prioritySort)
+	}
+	if m.pinView == pinsFirst {
+		sort.SliceStable(m.visible, func(i, j int) bool {
+			return m.pinned[m.visible[i].Name] && !m.pinned[m.visible[j].Name]
+		})
+	}
+	statusCells := make([]string, len(m.visible))
+	m.statusWidth = 0
+	for i, server := range m.visible {
+		status := server.Status
+		if m.iconMode {
+			status = statusIcon(status)
+		}
+		if badge, ok := maintenanceCountdown(server, now); ok {
+			status += " " + badge
+			m.statusWidth = max(m.statusWidth, ansi.StringWidth(status))
+		}
+		statusCells[i] = status
+	}
+	rows := []table.Row{}
+	widths := m.widths()
+	for i, server := range m.visible {
+		row := table.Row{m.displayName(server), m.displayIP(server.IP), server.Location, statusCells[i], m.formatReport(server.LastReport)}
+		for i := range row {
+			row[i] = alignCell(i, fitCell(row[i], widths[i]), widths[i])
+		}
+		rows = append(rows, row)
+	}
+	m.table.SetColumns(m.columns())
+	m.table.SetRows(rows)
+	// SetCursor on an empty table leaves the cursor at -1, so put it back on
+	// the first row once there are rows again.
+	if cursor := m.table.Cursor(); cursor < 0 || cursor >= len(rows) {
+		m.table.SetCursor(max(0, min(cursor, len(rows)-1)))
+	}
+	if hadSelection {
+		for i, server := range m.visible {
+			if server.Name == selected.Name {
+				m.table.SetCursor(i)
+				break
+			}
+		}
+	}
+}
+
+// tableHeaderStyle is each column title: the table's usual padding with a
+// rule underneath.
+var tableHeaderStyle = table.DefaultStyles().Header.BorderStyle(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("240")).BorderBottom(true).Bold(false)
+
+// selectedRowStyle highlights the row under the cursor.
+var selectedRowStyle = table.DefaultStyles().Selected.Foreground(lipgloss.Color("229")).Background(lipgloss.Color("99")).Bold(false)
+
+// changeHighlightTTL is how long a status change stays marked in the table.
+const changeHighlightTTL = 10 * time.Minute
+
+// trackStatusChanges records when servers present in both snapshots changed status.
+func (m *model) trackStatusChanges(servers []Server) {
+	previous := make(map[string]string, len(m.servers))
+	for _, server := range m.servers {
+		previous[server.Name] = server.Status
+	}
+	now := time.Now()
+	for name, at := range m.changedAt {
+		if now.Sub(at) >= changeHighlightTTL {
+			delete(m.changedAt, name)
+		}
+	}
+	for _, server := range servers {
+		if status, ok := previous[server.Name]; ok && status != server.Status {
+			m.changedAt[server.Name] = now
+		}
+	}
+}
+
+// expandTemplate replaces the {name}, {ip}, {location} and {status}
+// placeholders in tmpl with the server's fields.
+func expandTemplate(tmpl string, server Server) string {
+	return strings.NewReplacer(
+		"{name}", server.Name,
+		"{ip}", server.IP,
+		"{location}", server.Location,
+		"{status}", server.Status,
+	).Replace(tmpl)
+}
+
+// sshUser returns the {user} for SSH commands: the configured sshUser, else the local user.
+func (m model) sshUser() string {
+	if m.config.SshUser != "" {
+		return m.config.SshUser
+	}
+	return localUserName()
+}
+
+// localUserName returns the name of the user running the tool.
+func localUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// reportLayouts are the timestamp formats accepted for LastReport.
+var reportLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.RFC1123, time.RFC1123Z}
+
+// parseReportTime parses a LastReport timestamp in any of reportLayouts.
+func parseReportTime(value string) (time.Time, bool) {
+	for _, layout := range reportLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// formatReport renders a LastReport timestamp in the configured display
+// timezone, leaving it untouched when no zone is set or it can't be parsed.
+func (m model) formatReport(value string) string {
+	if m.displayLoc == nil {
+		return value
+	}
+	t, ok := parseReportTime(value)
+	if !ok {
+		return value
+	}
+	return t.In(m.displayLoc).Format("2006-01-02 15:04:05 MST")
+}
+
+// reportAge returns how long ago a server last reported, treating that as the
+// time it entered its current status. Unparseable or future times yield false.
+func reportAge(server Server, now time.Time) (time.Duration, bool) {
+	t, ok := parseReportTime(server.LastReport)
+	if !ok || t.After(now) {
+		return 0, false
+	}
+	return now.Sub(t), true
+}
+
+// staleThreshold is how old a report must be to count as stale.
+func (m model) staleThreshold() time.Duration {
+	if m.config == nil {
+		return time.Duration(defaultConfig().StaleThresholdMinutes) * time.Minute
+	}
+	return time.Duration(m.config.StaleThresholdMinutes) * time.Minute
+}
+
+// isStale reports whether a server's last report is older than the stale
+// threshold. Servers without a parseable report aren't counted.
+func (m model) isStale(server Server, now time.Time) bool {
+	age, ok := reportAge(server, now)
+	return ok && age > m.staleThreshold()
+}
+
+// formatAge renders a duration compactly, e.g. "45m", "2h13m" or "3d4h".
+func formatAge(d time.Duration) string {
+	d = d.Truncate(time.Minute)
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
+
+// statusWithAge describes a server's status along with how long it has held
+// it, e.g. "Offline for 2h13m", falling back to the bare status.
+func statusWithAge(server Server, now time.Time) string {
+	age, ok := reportAge(server, now)
+	if !ok {
+		return server.Status
+	}
+	return server.Status + " for " + formatAge(age)
+}
+
+// annotationDetail describes a server's local note for the detail view.
+func (m model) annotationDetail(name string) string {
+	if note := m.annotations[name]; note != "" {
+		return "⚑ " + note
+	}
+	return ""
+}
+
+// maintenanceCountdown describes how long a server's maintenance window has
+// left, e.g. "1h20m", or "overdue" once it has passed while the server is still
+// in Maintenance. It yields false for other statuses and for missing or
+// unparseable MaintenanceUntil values.
+func maintenanceCountdown(server Server, now time.Time) (string, bool) {
+	if server.Status != "Maintenance" || server.MaintenanceUntil == "" {
+		return "", false
+	}
+	until, ok := parseReportTime(server.MaintenanceUntil)
+	if !ok {
+		return "", false
+	}
+	if !until.After(now) {
+		return "overdue", true
+	}
+	return formatAge(until.Sub(now)), true
+}
+
+// maintenanceDetail describes the maintenance window for the detail view, e.g.
+// "ends in 1h20m (2024-05-01 18:00:00 UTC)", warning when it has expired but
+// the status hasn't changed back. Unparseable values are shown as-is.
+func (m model) maintenanceDetail(server Server, now time.Time) string {
+	if server.MaintenanceUntil == "" {
+		return ""
+	}
+	until, ok := parseReportTime(server.MaintenanceUntil)
+	if !ok {
+		return server.MaintenanceUntil + " (unrecognised time)"
+	}
+	when := m.formatReport(server.MaintenanceUntil)
+	switch {
+	case server.Status != "Maintenance":
+		return "until " + when
+	case until.After(now):
+		return fmt.Sprintf("maint ends in %s (%s)", formatAge(until.Sub(now)), when)
+	default:
+		return fmt.Sprintf("window ended %s ago (%s) but still in Maintenance", formatAge(now.Sub(until)), when)
+	}
+}
+
+// exportSet returns the servers an export should contain: the multi-selection
+// if there is one, the filtered rows while a filter is active, otherwise the
+// whole inventory.
+func (m model) exportSet() ([]Server, string) {
+	if selected := m.selectedServers(); len(selected) > 0 {
+		return selected, "selected"
+	}
+	if m.filterActive() {
+		return m.visible, "filtered"
+	}
+	return m.servers, "all"
+}
+
+// setTempMessage sets a message with a specific style and a timer to reset it.
+func (m *model) setTempMessage(style lipgloss.Style, message string) {
+	m.message = message
+	m.currentMsgStyle = style
+	if m.messageTimer != nil {
+		m.messageTimer.Stop()
+	}
+	if notify := m.notify; notify != nil {
+		m.messageTimer = time.AfterFunc(2*time.Second, func() {
+			notify(clearMessage{})
+		})
+	}
+}
+
+// --- API CLIENT ---
+
+// APIClient is the inventory backend the commands talk to. The TUI only uses
+// it through this interface so tests can substitute a fake.
+type APIClient interface {
+	List() (ListResult, error)
+	Get(name string) (Server, error)
+	Create(server Server) error
+	Upsert(server Server) error
+	Delete(name string) error
+	SetStatus(name, status string) error
+	Summary() (map[string]int, error)
+}
+
+// httpAPIClient implements APIClient against the inventory REST API.
+type httpAPIClient struct {
+	baseURL        string
+	token          string
+	client         *http.Client
+	envelopeField  string
+	maxRetries     int
+	retryMutations bool
+	inventoryPath  string
+	reportPath     string
+	deletePath     string
+	tokenFile      string // read for every request when set, overriding token
+	maxServers     int
+	summaryPath    string
+	onRetry        func(attempt, attempts int) // called before each retry, if set
+	userAgent      string
+	sleep          func(time.Duration) // waits between retries; time.Sleep
+}
+
+// newHTTPAPIClient returns a client for the API at baseURL authenticated with
+// a Bearer token, sending requests through client and taking the remaining
+// settings from config.
+func newHTTPAPIClient(baseURL, token string, client *http.Client, config *Config) *httpAPIClient {
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	return &httpAPIClient{
+		baseURL:        baseURL,
+		token:          token,
+		client:         client,
+		envelopeField:  config.ResponseEnvelopeField,
+		maxRetries:     config.MaxRetries,
+		retryMutations: config.RetryMutations,
+		inventoryPath:  strings.TrimRight(config.InventoryPath, "/"),
+		reportPath:     config.ReportPath,
+		deletePath:     strings.TrimRight(config.DeletePath, "/"),
+		tokenFile:      config.TokenFile,
+		maxServers:     config.MaxServers,
+		summaryPath:    config.SummaryEndpoint,
+		userAgent:      userAgent,
+		sleep:          time.Sleep,
+	}
+}
+
+// defaultUserAgent identifies this tool in the API's access logs.
+func defaultUserAgent() string {
+	v := version
+	if v == "" {
+		v = "dev"
+	}
+	return fmt.Sprintf("wolf-inv/%s (%s)", v, runtime.GOOS)
+}
+
+// authorize sets the Authorization header on req. With a token file the
+// token is read fresh each time, since an external agent may have rotated it.
+func (c *httpAPIClient) authorize(req *http.Request) error {
+	token, err := currentToken(c.token, c.tokenFile)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// currentToken returns the API token to send: the contents of tokenFile,
+// read afresh, when it is set, and token otherwise.
+func currentToken(token, tokenFile string) (string, error) {
+	if tokenFile == "" {
+		return token, nil
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read token file: %w", err)
+	}
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", tokenFile)
+	}
+	return token, nil
+}
+
+// newTUIClient is newHTTPAPIClient for the dashboard, which shows retries
+// while it is loading.
+func newTUIClient(baseURL, token string, client *http.Client, config *Config, notify func(tea.Msg)) *httpAPIClient {
+	api := newHTTPAPIClient(baseURL, token, client, config)
+	if notify != nil {
+		api.onRetry = func(attempt, attempts int) {
+			notify(retryingMsg{attempt: attempt, attempts: attempts})
+		}
+	}
+	return api
+}
+
+// newHTTPClient builds the HTTP client shared by all API clients, adding the
+// configured CA bundle and mutual TLS certificate. Without either it is
+// http.DefaultClient.
+func newHTTPClient(config *Config) (*http.Client, error) {
+	if config.CABundlePath == "" && config.ClientCertPath == "" && config.ClientKeyPath == "" {
+		return http.DefaultClient, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CABundlePath != "" {
+		pem, err := os.ReadFile(config.CABundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", config.CABundlePath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.ClientCertPath != "" || config.ClientKeyPath != "" {
+		if config.ClientCertPath == "" || config.ClientKeyPath == "" {
+			return nil, errors.New("clientCertPath and clientKeyPath must be set together")
+		}
+		// LoadX509KeyPair also rejects a key that doesn't belong to the certificate.
+		cert, err := tls.LoadX509KeyPair(config.ClientCertPath, config.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// retryBackoff is the delay before the first retry; it doubles on each attempt.
+const retryBackoff = 500 * time.Millisecond
+
+// do sends req, retrying according to the client's policy.
+//
+// Reads are idempotent, so they are retried on connection errors and 5xx
+// responses alike. Mutations are only retried when retryMutations is set, and
+// even then only when no response arrived at all: a 5xx may mean the backend
+// already applied the change, and replaying a POST could create a duplicate.
+func (c *httpAPIClient) do(req *http.Request, mutation bool) (*http.Response, error) {
+	req.Header.Set("User-Agent", c.userAgent)
+	retries := c.maxRetries
+	if mutation && !c.retryMutations {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.client.Do(req)
+		wait := retryBackoff << attempt
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			// Rate limited: reads wait as long as the API asks, mutations report it.
+			wait = retryAfter(resp.Header.Get("Retry-After"), time.Now(), wait)
+			if mutation || attempt >= retries {
+				resp.Body.Close()
+				return nil, &rateLimitError{wait: wait}
+			}
+		} else {
+			retryable := err != nil || (!mutation && resp.StatusCode >= 500)
+			if !retryable || attempt >= retries {
+				return resp, err
+			}
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if c.onRetry != nil {
+			c.onRetry(attempt+2, retries+1)
+		}
+		c.sleep(wait)
+		// Requests built from a bytes.Buffer can replay their body.
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// maxRetryAfter caps how long a Retry-After header can make us wait.
+const maxRetryAfter = time.Minute
+
+// rateLimitError reports a 429 response that was not (or no longer) retried.
+type rateLimitError struct{ wait time.Duration }
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited by API, retry in %ds", int(e.wait.Round(time.Second).Seconds()))
+}
+
+// retryAfter parses a Retry-After header given either as seconds or as an
+// HTTP date, capped at maxRetryAfter. fallback is used when it is missing or invalid.
+func retryAfter(header string, now time.Time, fallback time.Duration) time.Duration {
+	wait := fallback
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = max(at.Sub(now), 0)
+	}
+	return min(wait, maxRetryAfter)
+}
+
+// requestError wraps an error from do with context, passing rate-limit errors
+// through untouched since they already explain themselves.
+func requestError(context string, err error) error {
+	var limited *rateLimitError
+	if errors.As(err, &limited) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", context, err)
+}
+
+// ListResult is a decoded inventory along with anything noteworthy about the response.
+type ListResult struct {
+	Servers   []Server
+	Skipped   int    // records dropped because they could not be decoded
+	Truncated int    // records dropped past the maxServers cap
+	Raw       []byte // response body as received, for debugging
+}
+
+// maxResponseBytes caps how much of an inventory response is read, so a
+// runaway backend can't exhaust memory or freeze the UI while decoding.
+const maxResponseBytes = 64 << 20
+
+// List fetches all servers with GET on the inventory path (/inventory by default).
+func (c *httpAPIClient) List() (ListResult, error) {
+	req, err := http.NewRequest("GET", endpoint(c.baseURL, c.inventoryPath), nil)
+	if err != nil {
+		return ListResult{}, fmt.Errorf("could not create request: %w", err)
+	}
+	if err := c.authorize(req); err != nil {
+		return ListResult{}, err
+	}
+
+	resp, err := c.do(req, false)
+	if err != nil {
+		return ListResult{}, requestError("could not connect to API", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ListResult{}, fmt.Errorf("API request failed with status code %d", resp.StatusCode)
+	}
+	if err := expectJSON(req, resp); err != nil {
+		return ListResult{}, err
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return ListResult{}, fmt.Errorf("could not read API response: %w", err)
+	}
+	if len(raw) > maxResponseBytes {
+		return ListResult{}, fmt.Errorf("API response is larger than %d MB", maxResponseBytes>>20)
+	}
+	result, err := decodeServers(bytes.NewReader(raw), c.envelopeField, c.maxServers)
+	result.Raw = raw
+	return result, err
+}
+
+// expectJSON checks that a successful response is JSON before it is decoded.
+// The client follows redirects silently, so a moved API or an expired session
+// often shows up as a 200 HTML page instead; that is reported with the URL
+// the request ended up at. A missing Content-Type and text/plain, which is
+// what servers that don't set one sniff JSON as, are given the benefit of the
+// doubt.
+func expectJSON(req *http.Request, resp *http.Response) error {
+	header := resp.Header.Get("Content-Type")
+	if header == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err == nil && (mediaType == "application/json" || mediaType == "text/plain" || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	msg := fmt.Sprintf("expected JSON, got %s", header)
+	if err == nil {
+		msg = fmt.Sprintf("expected JSON, got %s", mediaType)
+	}
+	if final := resp.Request; final != nil && final.URL.String() != req.URL.String() {
+		return fmt.Errorf("%s after a redirect to %s — the API may have moved or be sending you to a login page", msg, final.URL.Redacted())
+	}
+	if mediaType == "text/html" {
+		return fmt.Errorf("%s — possibly a login page or proxy error; check apiBaseURL", msg)
+	}
+	return errors.New(msg)
+}
+
+// decodeServers decodes a server list that is either a bare JSON array or,
+// when envelopeField is set, wrapped in an object under that field. Records
+// are read one at a time; those that fail to decode are logged and skipped so
+// one bad entry doesn't hide the rest of the inventory. Past maxServers
+// records are only counted, never decoded; a non-positive maxServers means
+// no limit.
+func decodeServers(r io.Reader, envelopeField string, maxServers int) (ListResult, error) {
+	dec := json.NewDecoder(r)
+	if envelopeField != "" {
+		found, err := seekField(dec, envelopeField)
+		if err != nil {
+			return ListResult{}, fmt.Errorf("failed to decode JSON: %w", err)
+		}
+		if !found {
+			return ListResult{}, fmt.Errorf("response has no %q field", envelopeField)
+		}
+	}
+	result, err := decodeRecords(dec, maxServers)
+	if err != nil && envelopeField != "" {
+		return ListResult{}, fmt.Errorf("failed to decode %q field: %w", envelopeField, err)
+	}
+	if err != nil {
+		return ListResult{}, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return result, nil
+}
+
+// seekField advances dec into a JSON object until the value of field is
+// next, skipping the other fields. It reports false if there is no field.
+func seekField(dec *json.Decoder, field string) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if tok != json.Delim('{') {
+		return false, fmt.Errorf("expected an object, got %v", tok)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		if key == field {
+			return true, nil
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// decodeRecords reads a JSON array of servers from dec, keeping at most
+// maxServers of them. A JSON null is an empty list.
+func decodeRecords(dec *json.Decoder, maxServers int) (ListResult, error) {
+	result := ListResult{Servers: []Server{}}
+	tok, err := dec.Token()
+	if err != nil {
+		return ListResult{}, err
+	}
+	if tok == nil {
+		return result, nil
+	}
+	if tok != json.Delim('[') {
+		return ListResult{}, fmt.Errorf("expected an array, got %v", tok)
+	}
+	for i := 0; dec.More(); i++ {
+		var record json.RawMessage
+		if err := dec.Decode(&record); err != nil {
+			return ListResult{}, err
+		}
+		if maxServers > 0 && i >= maxServers {
+			result.Truncated++
+			continue
+		}
+		var server Server
+		if err := json.Unmarshal(record, &server); err != nil {
+			log.Printf("skipping server record %d: %v: %s", i, err, record)
+			result.Skipped++
+			continue
+		}
+		result.Servers = append(result.Servers, server)
+	}
+	if _, err := dec.Token(); err != nil { // the closing ]
+		return ListResult{}, err
+	}
+	return result, nil
+}
+
+// errNotFound is returned when the API answers 404 for a single resource.
+var errNotFound = errors.New("not found")
+
+// Get fetches a single server with GET {inventoryPath}/{name}.
+func (c *httpAPIClient) Get(name string) (Server, error) {
+	req, err := http.NewRequest("GET", endpoint(c.baseURL, c.inventoryPath+"/"+url.PathEscape(name)), nil)
+	if err != nil {
+		return Server{}, fmt.Errorf("could not create request: %w", err)
+	}
+	if err := c.authorize(req); err != nil {
+		return Server{}, err
+	}
+
+	resp, err := c.do(req, false)
+	if err != nil {
+		return Server{}, requestError("could not connect to API", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Server{}, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Server{}, fmt.Errorf("API request failed with status code %d", resp.StatusCode)
+	}
+	if err := expectJSON(req, resp); err != nil {
+		return Server{}, err
+	}
+	var server Server
+	if err := json.NewDecoder(resp.Body).Decode(&server); err != nil {
+		return Server{}, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return server, nil
+}
+
+// Create registers a brand-new server with POST to the inventory path.
+func (c *httpAPIClient) Create(server Server) error {
+	return c.send("POST", c.inventoryPath, server)
+}
+
+// Upsert updates an existing server with PUT to the report path.
+func (c *httpAPIClient) Upsert(server Server) error {
+	return c.send("PUT", c.reportPath, server)
+}
+
+// send submits server as a JSON body.
+func (c *httpAPIClient) send(method, path string, server Server) error {
+	jsonData, _ := json.Marshal(server)
+	req, err := http.NewRequest(method, endpoint(c.baseURL, path), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, true)
+	if err != nil {
+		return requestError("failed to send request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed: %s", string(body))
+	}
+	return nil
+}
+
+// Summary fetches the status counts from the summary endpoint.
+func (c *httpAPIClient) Summary() (map[string]int, error) {
+	req, err := http.NewRequest("GET", endpoint(c.baseURL, c.summaryPath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	if err := c.authorize(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req, false)
+	if err != nil {
+		return nil, requestError("could not connect to API", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed with status code %d", resp.StatusCode)
+	}
+	if err := expectJSON(req, resp); err != nil {
+		return nil, err
+	}
+	var counts map[string]int
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&counts); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return counts, nil
+}
+
+// SetStatus changes only a server's status with PATCH {inventoryPath}/{name}.
+func (c *httpAPIClient) SetStatus(name, status string) error {
+	jsonData, _ := json.Marshal(map[string]string{"status": status})
+	req, err := http.NewRequest("PATCH", endpoint(c.baseURL, c.inventoryPath+"/"+url.PathEscape(name)), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, true)
+	if err != nil {
+		return requestError("failed to send request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed: %s", string(body))
+	}
+	return nil
+}
+
+// Delete removes a server with DELETE {deletePath}/{name}.
+func (c *httpAPIClient) Delete(name string) error {
+	req, err := http.NewRequest("DELETE", endpoint(c.baseURL, c.deletePath+"/"+url.PathEscape(name)), nil)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, true)
+	if err != nil {
+		return requestError("failed to send request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed: %s", string(body))
+	}
+	return nil
+}
+
+// endpoint joins the API base URL and a path, dropping any trailing slash on
+// the base and assuming https when the configured URL has no scheme.
+func endpoint(apiURL, path string) string {
+	base := strings.TrimRight(apiURL, "/")
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	return base + path
+}
+
+// --- COMMANDS & MESSAGES ---
+
+type serverMsg struct {
+	servers   []Server
+	skipped   int       // records the API returned that could not be decoded
+	truncated int       // records dropped past the maxServers cap
+	raw       []byte    // the response body, kept for the raw response view
+	api       APIClient // the client that fetched them; stale once the environment changes
+}
+type serverRefreshedMsg struct{ server Server }
+type savedMsg struct{ server Server }
+type saveFailedMsg struct {
+	server Server
+	err    error
+}
+type deleteDoneMsg struct{ name string }
+type decommissionedMsg struct{ name string }
+type deleteFailedMsg struct {
+	name string
+	err  error
+}
+type errMsg struct {
+	err   error
+	fetch bool      // the inventory itself could not be loaded
+	api   APIClient // for fetch errors, the client that failed
+}
+
+func (e errMsg) Error() string { return e.err.Error() }
+
+type fetchServersMsg struct{ gen int }
+type editorClosedMsg struct{ err error }
+type retryingMsg struct{ attempt, attempts int } // a request is about to be retried
+type summaryMsg struct{ counts map[string]int }  // nil when the summary is unavailable
+type exportedMsg struct {
+	path  string
+	count int
+	scope string // which servers were exported, e.g. "filtered" or "all"
+}
+type snapshotMsg struct{ textPath, csvPath string }
+type pingResultMsg struct {
+	sweep  int
+	result pingResult
+}
+type pingDoneMsg struct{ sweep int }
+type bulkProgressMsg struct {
+	done, total int
+	failed      []string // names the API rejected so far
+	succeeded   []string // names the API accepted so far
+	action      string   // "update", "delete", "decommission" or "import"
+}
+type configReloadedMsg struct {
+	config     *Config
+	httpClient *http.Client
+	envName    string
+	env        EnvConfig
+}
+type historyLoadedMsg struct{ entries []historyEntry }
+type importLoadedMsg struct {
+	path    string
+	servers []Server
+}
+type importDoneMsg struct {
+	created, updated, skipped int
+	failed                    []string // names the API rejected
+}
+type retryFetchMsg struct{}
+type createdMsg struct{ server Server }
+type clearMessage struct{}
+
+// fetchServers loads the inventory through the API client, recording the
+// fetch in metrics when it isn't nil.
+func fetchServers(api APIClient, metrics *fetchMetrics) tea.Cmd {
+	return func() tea.Msg {
+		start := time.Now()
+		result, err := api.List()
+		metrics.recordFetch(time.Since(start), result.Servers, err)
+		if err != nil {
+			return errMsg{err: err, fetch: true, api: api}
+		}
+		return serverMsg{servers: result.Servers, skipped: result.Skipped, truncated: result.Truncated, raw: result.Raw, api: api}
+	}
+}
+
+// fetchSummary loads the authoritative status counts. Failures fall back to
+// counting the fetched servers, so they are logged rather than shown.
+func fetchSummary(api APIClient) tea.Cmd {
+	return func() tea.Msg {
+		counts, err := api.Summary()
+		if err != nil {
+			log.Printf("summary endpoint: %v", err)
+		}
+		return summaryMsg{counts: counts}
+	}
+}
+
+// refreshServer re-fetches a single server. Backends without the
+// single-server endpoint answer 404, in which case the whole inventory is fetched.
+func refreshServer(api APIClient, metrics *fetchMetrics, name string) tea.Cmd {
+	return func() tea.Msg {
+		server, err := api.Get(name)
+		if errors.Is(err, errNotFound) {
+			return fetchServers(api, metrics)()
+		}
+		if err != nil {
+			return errMsg{err: err}
+		}
+		return serverRefreshedMsg{server: server}
+	}
+}
+
+// createServer registers a brand-new server. The inventory is refreshed once
+// the user is done adding, so unlike edits no fetch is chained here.
+func createServer(api APIClient, serverData Server) tea.Cmd {
+	return func() tea.Msg {
+		if err := api.Create(serverData); err != nil {
+			return saveFailedMsg{server: serverData, err: err}
+		}
+		return createdMsg{server: serverData}
+	}
+}
+
+// addOrEditServer updates an existing server.
+func addOrEditServer(api APIClient, serverData Server) tea.Cmd {
+	return func() tea.Msg {
+		if err := api.Upsert(serverData); err != nil {
+			return saveFailedMsg{server: serverData, err: err}
+		}
+		return savedMsg{server: serverData}
+	}
+}
+
+// deleteServer removes a server by name. The refresh that follows is issued
+// separately so that a failing fetch isn't mistaken for a failed delete.
+func deleteServer(api APIClient, serverName string) tea.Cmd {
+	return func() tea.Msg {
+		if err := api.Delete(serverName); err != nil {
+			return deleteFailedMsg{name: serverName, err: err}
+		}
+		return deleteDoneMsg{name: serverName}
+	}
+}
+
+// decommissionServer sets a server's status to status instead of deleting it.
+func decommissionServer(api APIClient, serverName, status string) tea.Cmd {
+	return func() tea.Msg {
+		if err := api.SetStatus(serverName, status); err != nil {
+			return errMsg{err: fmt.Errorf("could not decommission '%s': %w", serverName, err)}
+		}
+		return decommissionedMsg{name: serverName}
+	}
+}
+
+// announceDeletes tells the Slack webhook, if one is configured, that names
+// were deleted. A bulk delete is announced as one message.
+func (m model) announceDeletes(names []string) tea.Cmd {
+	if m.config == nil || m.config.SlackWebhookURL == "" || len(names) == 0 {
+		return nil
+	}
+	text := fmt.Sprintf(":wastebasket: %s deleted server %s", localUserName(), names[0])
+	if len(names) > 1 {
+		text = fmt.Sprintf(":wastebasket: %s deleted %d servers: %s", localUserName(), len(names), strings.Join(names, ", "))
+	}
+	if m.envName != "" {
+		text += " in " + m.envName
+	}
+	return notifySlack(m.config.SlackWebhookURL, text)
+}
+
+// slackTimeout bounds how long a Slack notification may take.
+const slackTimeout = 5 * time.Second
+
+// reloadConfig reads the config file again, staying in envName if it still
+// exists. On any error the running config is kept and the error shown.
+func reloadConfig(envName string) tea.Cmd {
+	return func() tea.Msg {
+		config, err := loadConfig()
+		if err != nil {
+			return errMsg{err: fmt.Errorf("config not reloaded: %w", err)}
+		}
+		httpClient, err := newHTTPClient(config)
+		if err != nil {
+			return errMsg{err: fmt.Errorf("config not reloaded: %w", err)}
+		}
+		if env, ok := config.Environments[envName]; ok {
+			return configReloadedMsg{config: config, httpClient: httpClient, envName: envName, env: env}
+		}
+		name, env, err := config.activeEnv()
+		if err != nil {
+			return errMsg{err: fmt.Errorf("config not reloaded: %w", err)}
+		}
+		return configReloadedMsg{config: config, httpClient: httpClient, envName: name, env: env}
+	}
+}
+
+// editConfig suspends the dashboard to edit the config file in $EDITOR,
+// falling back to vi (notepad on Windows).
+func editConfig(path string) tea.Cmd {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			editor = []string{"notepad"}
+		}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return editorClosedMsg{err: err}
+	})
+}
+
+// savePollInterval writes the poll interval back to the config file.
+func savePollInterval(configPath string, seconds int) tea.Cmd {
+	return func() tea.Msg {
+		if err := setConfigValue(configPath, "pollIntervalSeconds", seconds); err != nil {
+			return errMsg{err: fmt.Errorf("could not save the poll interval: %w", err)}
+		}
+		return nil
+	}
+}
+
+// savePinned writes the pinned server names back to the config file.
+func savePinned(configPath string, names []string) tea.Cmd {
+	return func() tea.Msg {
+		if err := setConfigValue(configPath, "pinned", names); err != nil {
+			return errMsg{err: fmt.Errorf("could not save pinned servers: %w", err)}
+		}
+		return nil
+	}
+}
+
+// annotationsPath is where local server notes are kept: annotations.json
+// beside the config file, or nowhere when the config has no path.
+func annotationsPath(config *Config) string {
+	if config == nil || config.path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(config.path), "annotations.json")
+}
+
+// loadAnnotations reads the local server notes. A missing file means no
+// notes; an unreadable one is logged and treated the same.
+func loadAnnotations(path string) map[string]string {
+	annotations := map[string]string{}
+	if path == "" {
+		return annotations
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("annotations: %v", err)
+		}
+		return annotations
+	}
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		log.Printf("annotations: could not parse %s: %v", path, err)
+		return map[string]string{}
+	}
+	return annotations
+}
+
+// saveAnnotations writes the local server notes to path, replacing the file
+// in one rename so a crash can't leave it truncated.
+func saveAnnotations(path string, annotations map[string]string) tea.Cmd {
+	if path == "" {
+		return nil
+	}
+	data, _ := json.MarshalIndent(annotations, "", "  ")
+	return func() tea.Msg {
+		if err := writeFileAtomic(path, append(data, '\n'), 0o600); err != nil {
+			return errMsg{err: fmt.Errorf("could not save notes: %w", err)}
+		}
+		return nil
+	}
+}
+
+// notifySlack posts text to a Slack incoming webhook. Notifications are best
+// effort: failures are logged and never shown as errors.
+func notifySlack(webhookURL, text string) tea.Cmd {
+	return func() tea.Msg {
+		body, _ := json.Marshal(map[string]string{"text": text})
+		client := http.Client{Timeout: slackTimeout}
+		resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("slack: %v", err)
+			return nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("slack: webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// openURL opens target in the system's default browser.
+func openURL(target string) tea.Cmd {
+	return func() tea.Msg {
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", target)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+		default:
+			cmd = exec.Command("xdg-open", target)
+		}
+		if err := cmd.Start(); err != nil {
+			return errMsg{err: fmt.Errorf("could not open %s: %w", target, err)}
+		}
+		// Reap the launcher so it doesn't linger as a zombie.
+		go cmd.Wait()
+		return nil
+	}
+}
+
+// Startup retry policy: while nothing has loaded yet, failed fetches are
+// retried after startupRetryBase, doubling up to startupRetryMax, at most
+// startupRetries times. After that the user refreshes manually with 'r'.
+const (
+	startupRetries   = 5
+	startupRetryBase = 2 * time.Second
+	startupRetryMax  = 30 * time.Second
+)
+
+// exportServers writes servers to a timestamped CSV or JSON file in the current directory.
+func exportServers(servers []Server, scope, format string) tea.Cmd {
+	return func() tea.Msg {
+		path := fmt.Sprintf("wolf-inv-export-%s.%s", time.Now().Format("20060102-150405"), format)
+		file, err := os.Create(path)
+		if err != nil {
+			return errMsg{err: fmt.Errorf("could not create export file: %w", err)}
+		}
+		defer file.Close()
+
+		if format == "json" {
+			enc := json.NewEncoder(file)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(servers)
+		} else {
+			err = writeServersCSV(file, servers)
+		}
+		if err != nil {
+			return errMsg{err: fmt.Errorf("could not write export file: %w", err)}
+		}
+		return exportedMsg{path: path, count: len(servers), scope: scope}
+	}
+}
+
+// saveSnapshot writes the table as rendered, without colors, next to a CSV of
+// the same servers in the same order, so a ticket can show exactly what was seen.
+func saveSnapshot(rendered string, servers []Server) tea.Cmd {
+	return func() tea.Msg {
+		base := "wolf-inv-snapshot-" + time.Now().Format("20060102-150405")
+		textPath, csvPath := base+".txt", base+".csv"
+		if err := os.WriteFile(textPath, []byte(rendered+"\n"), 0o644); err != nil {
+			return errMsg{err: fmt.Errorf("could not write snapshot: %w", err)}
+		}
+		var buf bytes.Buffer
+		if err := writeServersCSV(&buf, servers); err != nil {
+			return errMsg{err: fmt.Errorf("could not write snapshot: %w", err)}
+		}
+		if err := os.WriteFile(csvPath, buf.Bytes(), 0o644); err != nil {
+			return errMsg{err: fmt.Errorf("could not write snapshot: %w", err)}
+		}
+		return snapshotMsg{textPath: textPath, csvPath: csvPath}
+	}
+}
+
+// writeServersCSV writes servers as CSV with a header row.
+func writeServersCSV(w io.Writer, servers []Server) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "ip", "location", "status", "last_report", "modified_by", "modified_at", "services"})
+	for _, server := range servers {
+		cw.Write([]string{server.Name, server.IP, server.Location, server.Status, server.LastReport, server.ModifiedBy, server.ModifiedAt, strings.Join(server.Services, ";")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// pingWorkers bounds how many dials a sweep has in flight at once.
+const pingWorkers = 16
+
+// pingTimeout is how long a single dial may take before the host counts as unreachable.
+const pingTimeout = 3 * time.Second
+
+// pingResult is the outcome of dialing one server.
+// errNoValidIP is the result for servers whose IP can't be dialed.
+var errNoValidIP = errors.New("no valid IP")
+
+type pingResult struct {
+	name    string
+	latency time.Duration
+	err     error
+}
+
+// pingSweep is the state of the reachability sweep shown in the PingAll view.
+type pingSweep struct {
+	id      int // distinguishes results of a cancelled sweep from the current one
+	servers []Server
+	results map[string]pingResult
+	ch      <-chan pingResult
+	cancel  context.CancelFunc
+	done    bool
+}
+
+// startPingSweep dials every server's IP on port using a bounded pool of
+// workers, sending results as they complete. The channel is closed once all
+// servers are done or ctx is cancelled.
+func startPingSweep(ctx context.Context, servers []Server, port int) <-chan pingResult {
+	jobs := make(chan Server)
+	results := make(chan pingResult)
+	var wg sync.WaitGroup
+	for range min(pingWorkers, len(servers)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dialer := net.Dialer{Timeout: pingTimeout}
+			for server := range jobs {
+				start := time.Now()
+				// An empty IP would dial this machine, and a name would be looked up.
+				err := errNoValidIP
+				if validIP(server.IP) {
+					var conn net.Conn
+					if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(server.IP, strconv.Itoa(port))); err == nil {
+						conn.Close()
+					}
 				}
-				coloredStatus := statusStyle.Render(server.Status)
-				line = strings.Replace(line, paddedStatus, coloredStatus, 1)
-				if serverIndex%2 == 1 && serverIndex != selectedRowIndex {
-					line = lipgloss.NewStyle().Background(lipgloss.Color("236")).Render(line)
+				select {
+				case results <- pingResult{name: server.Name, latency: time.Since(start), err: err}:
+				case <-ctx.Done():
+					return
 				}
-				lines[i] = line
-				serverIndex++
 			}
-		}
-		s += m.tableStyle.Render(strings.Join(lines, "\n"))
-	} else {
-		s += "No servers in inventory. Press 'a' to add one."
+		}()
 	}
-	s += "\n\n" + m.messageStyle.Render("'a' add | 'd' delete | 'e' edit | '?' help | 'q' quit")
-	return s
+	go func() {
+		defer close(jobs)
+		for _, server := range servers {
+			select {
+			case jobs <- server:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
 }
 
-// addingEditingView renders the form for adding or editing a server.
-func (m model) addingEditingView() string {
-	s := ""
-	switch m.addingState {
-	case InputName, InputIP, InputLocation:
-		s += fmt.Sprintf("Enter %s:\n\n%s", m.textInput.Placeholder, m.textInput.View())
-		s += "\n\n" + m.messageStyle.Render("Press 'Enter' to confirm, 'Esc' to cancel.")
-	case InputStatus:
-		s += fmt.Sprintf("Select a Status:\n\n%s", m.statusList.View())
-		s += "\n\n" + m.messageStyle.Render("Press 'Enter' to confirm, 'Esc' to cancel.")
-	case Confirm:
-		s += fmt.Sprintf("Confirm entry?\n\n  Name:     %s\n  IP:       %s\n  Location: %s\n  Status:   %s",
-			m.currentServer.Name, m.currentServer.IP, m.currentServer.Location, m.currentServer.Status)
-		s += "\n\n" + m.messageStyle.Render("Press 'y' to submit, 'n' or 'Esc' to cancel.")
+// waitForPing delivers the next result of a sweep, or pingDoneMsg once it is finished.
+func waitForPing(sweep int, ch <-chan pingResult) tea.Cmd {
+	return func() tea.Msg {
+		result, ok := <-ch
+		if !ok {
+			return pingDoneMsg{sweep: sweep}
+		}
+		return pingResultMsg{sweep: sweep, result: result}
 	}
-	return s
 }
 
-// helpView renders the help screen.
-func (m model) helpView() string {
-	return m.helpStyle.Render(
-		"--- Help ---\n\n" +
-			"  a: Add a new server\n" +
-			"  e: Edit selected server\n" +
-			"  d: Delete selected server\n" +
-			"  r: Refresh server list\n" +
-			"  ?: Show this help menu\n" +
-			"  q: Quit the application\n\n" +
-			"Press any key to return to the main view.",
-	)
+// historyMaxBytes is the size at which the history file is rotated to <file>.1.
+const historyMaxBytes = 1 << 20
+
+// historyViewLimit is how many of the most recent history entries the viewer loads.
+const historyViewLimit = 500
+
+// historyMu serializes history writes, since fetches can complete back to back.
+var historyMu sync.Mutex
+
+// historyEntry is one observed change to the inventory, stored as a JSON line.
+type historyEntry struct {
+	Time    time.Time       `json:"time"`
+	Added   []string        `json:"added,omitempty"`
+	Removed []string        `json:"removed,omitempty"`
+	Changed []historyChange `json:"changed,omitempty"`
 }
 
-// --- UTILITIES ---
+// historyChange lists the field changes of one server.
+type historyChange struct {
+	Name    string   `json:"name"`
+	Changes []string `json:"changes"`
+	Status  bool     `json:"status,omitempty"` // the status was one of the changes
+}
 
-// updateTable updates the table model with new server data.
-func (m *model) updateTable() {
-	columns := []table.Column{
-		{Title: "Name", Width: 20}, {Title: "IP Address", Width: 18},
-		{Title: "Location", Width: 18}, {Title: "Status", Width: 12},
-		{Title: "Last Report", Width: 35},
+// diffInventories compares two inventories by server name.
+func diffInventories(old, updated []Server) historyEntry {
+	var entry historyEntry
+	previous := make(map[string]Server, len(old))
+	for _, server := range old {
+		previous[server.Name] = server
 	}
-	rows := []table.Row{}
-	for _, server := range m.servers {
-		status := server.Status
-		if len(status) < 12 {
-			status = status + strings.Repeat(" ", 12-len(status))
+	seen := make(map[string]bool, len(updated))
+	for _, server := range updated {
+		seen[server.Name] = true
+		before, ok := previous[server.Name]
+		if !ok {
+			entry.Added = append(entry.Added, server.Name)
+		} else if changes := fieldChanges(before, server); len(changes) > 0 {
+			lines := make([]string, len(changes))
+			for i, change := range changes {
+				lines[i] = fmt.Sprintf("%s: %s → %s", change.field, change.from, change.to)
+			}
+			entry.Changed = append(entry.Changed, historyChange{
+				Name:    server.Name,
+				Changes: lines,
+				Status:  before.Status != server.Status,
+			})
 		}
-		rows = append(rows, table.Row{server.Name, server.IP, server.Location, status, server.LastReport})
 	}
-	m.table.SetColumns(columns)
-	m.table.SetRows(rows)
-	s := table.DefaultStyles()
-	s.Header = s.Header.BorderStyle(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("240")).BorderBottom(true).Bold(false)
-	s.Selected = s.Selected.Foreground(lipgloss.Color("229")).Background(lipgloss.Color("99")).Bold(false)
-	m.table.SetStyles(s)
+	for _, server := range old {
+		if !seen[server.Name] {
+			entry.Removed = append(entry.Removed, server.Name)
+		}
+	}
+	return entry
 }
 
-// setTempMessage sets a message with a specific style and a timer to reset it.
-func (m *model) setTempMessage(style lipgloss.Style, message string) {
-	m.message = message
-	m.currentMsgStyle = style
-	if m.messageTimer != nil {
-		m.messageTimer.Stop()
+// summary describes the entry in one line, e.g. "+2 added, -1 removed, 3
+// status changes". It is empty when nothing changed.
+func (e historyEntry) summary() string {
+	var parts []string
+	if len(e.Added) > 0 {
+		parts = append(parts, fmt.Sprintf("+%d added", len(e.Added)))
 	}
-	m.messageTimer = time.AfterFunc(2*time.Second, func() {
-		p.Send(clearMessage{})
-	})
+	if len(e.Removed) > 0 {
+		parts = append(parts, fmt.Sprintf("-%d removed", len(e.Removed)))
+	}
+	status, other := 0, 0
+	for _, changed := range e.Changed {
+		if changed.Status {
+			status++
+		} else {
+			other++
+		}
+	}
+	count := func(n int, what string) {
+		if n == 1 {
+			parts = append(parts, fmt.Sprintf("1 %s change", what))
+		} else if n > 1 {
+			parts = append(parts, fmt.Sprintf("%d %s changes", n, what))
+		}
+	}
+	count(status, "status")
+	count(other, "other")
+	return strings.Join(parts, ", ")
 }
 
-// --- COMMANDS & MESSAGES ---
-
-type serverMsg struct{ servers []Server }
-type errMsg struct{ err error }
-
-func (e errMsg) Error() string { return e.err.Error() }
+// recordHistory compares servers with the snapshot kept next to the history
+// file and, if anything changed, appends the difference and updates the snapshot.
+// Failures are only logged; history must never get in the way of the dashboard.
+func recordHistory(path string, servers []Server) tea.Cmd {
+	return func() tea.Msg {
+		historyMu.Lock()
+		defer historyMu.Unlock()
+		if err := appendHistory(path, servers, time.Now()); err != nil {
+			log.Printf("history: %v", err)
+		}
+		return nil
+	}
+}
 
-type fetchServersMsg struct{}
-type clearMessage struct{}
+// appendHistory does the work of recordHistory.
+func appendHistory(path string, servers []Server, now time.Time) error {
+	snapshotPath := path + ".last.json"
+	var previous []Server
+	data, err := os.ReadFile(snapshotPath)
+	if err == nil {
+		if err := json.Unmarshal(data, &previous); err != nil {
+			return fmt.Errorf("could not read snapshot: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
 
-// Updated fetchServers to accept and use the API token
-func fetchServers(apiURL, apiToken string) tea.Cmd {
-	return func() tea.Msg {
-		req, err := http.NewRequest("GET", apiURL+"/inventory", nil)
+	entry := diffInventories(previous, servers)
+	if data != nil && len(entry.Added)+len(entry.Removed)+len(entry.Changed) == 0 {
+		return nil
+	}
+	// The first snapshot only sets the baseline; listing every server as added isn't useful.
+	if data != nil {
+		entry.Time = now
+		if info, err := os.Stat(path); err == nil && info.Size() > historyMaxBytes {
+			if err := os.Rename(path, path+".1"); err != nil {
+				return fmt.Errorf("could not rotate: %w", err)
+			}
+		}
+		line, _ := json.Marshal(entry)
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 		if err != nil {
-			return errMsg{err: fmt.Errorf("could not create request: %w", err)}
+			return err
+		}
+		_, err = file.Write(append(line, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
 		}
-		// Set the Authorization header
-		req.Header.Set("Authorization", "Bearer "+apiToken)
-
-		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			return errMsg{err: fmt.Errorf("could not connect to API: %w", err)}
+			return err
 		}
-		defer resp.Body.Close()
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return errMsg{err: fmt.Errorf("API request failed with status code %d", resp.StatusCode)}
+	snapshot, _ := json.Marshal(servers)
+	return os.WriteFile(snapshotPath, snapshot, 0644)
+}
+
+// loadHistory reads the most recent entries of the history file.
+func loadHistory(path string) tea.Cmd {
+	return func() tea.Msg {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return errMsg{err: fmt.Errorf("could not read history: %w", err)}
+		}
+		var entries []historyEntry
+		for _, line := range strings.Split(string(data), "\n") {
+			var entry historyEntry
+			if line == "" || json.Unmarshal([]byte(line), &entry) != nil {
+				continue
+			}
+			entries = append(entries, entry)
 		}
-		var servers []Server
-		if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
-			return errMsg{err: fmt.Errorf("failed to decode JSON: %w", err)}
+		if len(entries) > historyViewLimit {
+			entries = entries[len(entries)-historyViewLimit:]
 		}
-		return serverMsg{servers: servers}
+		return historyLoadedMsg{entries: entries}
+	}
+}
+
+// runBulkUpdate saves servers in the background, at most limit at a time,
+// reporting progress after each.
+func runBulkUpdate(api APIClient, servers []Server, limit int) <-chan bulkProgressMsg {
+	return runBulk(servers, "update", limit, api.Upsert)
+}
+
+// runBulkDelete deletes servers in the background, reporting progress like runBulkUpdate.
+func runBulkDelete(api APIClient, servers []Server, limit int) <-chan bulkProgressMsg {
+	return runBulk(servers, "delete", limit, func(server Server) error { return api.Delete(server.Name) })
+}
+
+// runBulkDecommission sets each server's status to status instead of deleting it.
+func runBulkDecommission(api APIClient, servers []Server, status string, limit int) <-chan bulkProgressMsg {
+	return runBulk(servers, "decommission", limit, func(server Server) error { return api.SetStatus(server.Name, status) })
+}
+
+// runBulk applies op to each server with at most limit calls in flight,
+// sending a progress report as each one finishes.
+func runBulk(servers []Server, action string, limit int, op func(Server) error) <-chan bulkProgressMsg {
+	progress := make(chan bulkProgressMsg, len(servers))
+	go func() {
+		defer close(progress)
+		var mu sync.Mutex
+		var failed, succeeded []string
+		done := 0
+		forEachLimited(len(servers), limit, func(i int) {
+			err := op(servers[i])
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("bulk %s %s: %v", action, servers[i].Name, err)
+				failed = append(failed, servers[i].Name)
+			} else {
+				succeeded = append(succeeded, servers[i].Name)
+			}
+			done++
+			// Sent under the lock so reports arrive with done increasing.
+			progress <- bulkProgressMsg{
+				done:      done,
+				total:     len(servers),
+				failed:    append([]string(nil), failed...),
+				succeeded: append([]string(nil), succeeded...),
+				action:    action,
+			}
+		})
+	}()
+	return progress
+}
+
+// forEachLimited calls fn for every index below n from its own goroutine,
+// using a semaphore to keep at most limit calls running, and waits for all.
+func forEachLimited(n, limit int, fn func(i int)) {
+	sem := make(chan struct{}, max(1, limit))
+	var wg sync.WaitGroup
+	for i := range n {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
 	}
+	wg.Wait()
 }
 
-// Updated addOrEditServer to accept and use the API token
-func addOrEditServer(apiURL, apiToken string, serverData Server) tea.Cmd {
+// waitForBulk delivers the next progress report of a bulk update.
+func waitForBulk(progress <-chan bulkProgressMsg) tea.Cmd {
 	return func() tea.Msg {
-		jsonData, _ := json.Marshal(serverData)
-		req, err := http.NewRequest("POST", apiURL+"/report", bytes.NewBuffer(jsonData))
-		if err != nil {
-			return errMsg{err: fmt.Errorf("could not create request: %w", err)}
-		}
-		// Set headers
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+apiToken)
+		return <-progress
+	}
+}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return errMsg{err: fmt.Errorf("failed to send request: %w", err)}
+// readServersCSV reads servers from CSV with a header row, as written by
+// writeServersCSV. Columns are matched by name; fields the backend owns are ignored.
+func readServersCSV(r io.Reader) ([]Server, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	columns := map[string]int{}
+	for i, title := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(title))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("missing a name column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	var servers []Server
+	for line, record := range records[1:] {
+		server := Server{
+			Name:     field(record, "name"),
+			IP:       field(record, "ip"),
+			Location: field(record, "location"),
+			Status:   field(record, "status"),
+			Services: parseServices(field(record, "services")),
+		}
+		if server.Name == "" {
+			return nil, fmt.Errorf("row %d has no name", line+2)
 		}
-		defer resp.Body.Close()
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return errMsg{err: fmt.Errorf("API request failed: %s", string(body))}
+// importPlan splits the servers being imported by whether they already exist.
+type importPlan struct {
+	added      []Server
+	duplicates []Server
+}
+
+// analyzeImport compares incoming servers against the current inventory by name.
+func analyzeImport(incoming, existing []Server) importPlan {
+	known := make(map[string]bool, len(existing))
+	for _, server := range existing {
+		known[server.Name] = true
+	}
+	var plan importPlan
+	for _, server := range incoming {
+		if known[server.Name] {
+			plan.duplicates = append(plan.duplicates, server)
+		} else {
+			plan.added = append(plan.added, server)
 		}
-		// Pass the token to the subsequent fetch
-		return fetchServers(apiURL, apiToken)()
 	}
+	return plan
 }
 
-// Updated deleteServer to accept and use the API token
-func deleteServer(apiURL, apiToken, serverName string) tea.Cmd {
+// loadImport reads a CSV file for import.
+func loadImport(path string) tea.Cmd {
 	return func() tea.Msg {
-		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/delete/%s", apiURL, serverName), nil)
+		file, err := os.Open(path)
 		if err != nil {
-			return errMsg{err: fmt.Errorf("could not create request: %w", err)}
+			return errMsg{err: fmt.Errorf("could not open import file: %w", err)}
 		}
-		// Set the Authorization header
-		req.Header.Set("Authorization", "Bearer "+apiToken)
-
-		resp, err := http.DefaultClient.Do(req)
+		defer file.Close()
+		servers, err := readServersCSV(file)
 		if err != nil {
-			return errMsg{err: fmt.Errorf("failed to send request: %w", err)}
+			return errMsg{err: fmt.Errorf("could not read %s: %w", filepath.Base(path), err)}
 		}
-		defer resp.Body.Close()
+		return importLoadedMsg{path: path, servers: servers}
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return errMsg{err: fmt.Errorf("API request failed: %s", string(body))}
+// importServers creates the added servers and overwrites the given existing
+// ones in the background, at most limit at a time, reporting progress after each.
+func importServers(api APIClient, added, overwrite []Server, limit int) <-chan bulkProgressMsg {
+	create := make(map[string]bool, len(added))
+	for _, server := range added {
+		create[server.Name] = true
+	}
+	servers := append(append([]Server(nil), added...), overwrite...)
+	return runBulk(servers, "import", limit, func(server Server) error {
+		if create[server.Name] {
+			return api.Create(server)
+		}
+		return api.Upsert(server)
+	})
+}
+
+// importResult tallies the final progress report of an import against its plan.
+func importResult(plan importPlan, msg bulkProgressMsg) importDoneMsg {
+	added := make(map[string]bool, len(plan.added))
+	for _, server := range plan.added {
+		added[server.Name] = true
+	}
+	done := importDoneMsg{
+		skipped: len(plan.added) + len(plan.duplicates) - msg.total,
+		failed:  append([]string(nil), msg.failed...),
+	}
+	for _, name := range msg.succeeded {
+		if added[name] {
+			done.created++
+		} else {
+			done.updated++
+		}
+	}
+	sort.Strings(done.failed)
+	return done
+}
+
+// listFormatters write the inventory for -list, keyed by their -format name.
+var listFormatters = map[string]func(io.Writer, []Server) error{
+	"table": func(w io.Writer, servers []Server) error { return writeServersTable(w, servers, false) },
+	"wide":  func(w io.Writer, servers []Server) error { return writeServersTable(w, servers, true) },
+	"csv":   writeServersCSV,
+	"json": func(w io.Writer, servers []Server) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(servers)
+	},
+}
+
+// listFormatNames returns the supported -format values in sorted order.
+func listFormatNames() []string {
+	names := make([]string, 0, len(listFormatters))
+	for name := range listFormatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeServersTable writes servers as aligned plain-text columns; wide adds
+// the report and audit fields.
+func writeServersTable(w io.Writer, servers []Server, wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if wide {
+		fmt.Fprintln(tw, "NAME\tIP\tLOCATION\tSTATUS\tLAST REPORT\tMODIFIED BY\tMODIFIED AT\tSERVICES")
+	} else {
+		fmt.Fprintln(tw, "NAME\tIP\tLOCATION\tSTATUS")
+	}
+	for _, server := range servers {
+		if wide {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", server.Name, server.IP, server.Location, server.Status, server.LastReport, server.ModifiedBy, server.ModifiedAt, strings.Join(server.Services, ","))
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", server.Name, server.IP, server.Location, server.Status)
 		}
-		// Pass the token to the subsequent fetch
-		return fetchServers(apiURL, apiToken)()
 	}
+	return tw.Flush()
 }
 
-func pollForUpdates(d time.Duration) tea.Cmd {
-	return tea.Tick(d, func(t time.Time) tea.Msg {
-		return fetchServersMsg{}
+// minPollInterval and maxPollInterval bound the poll interval.
+const (
+	minPollInterval = 5 * time.Second
+	maxPollInterval = 10 * time.Minute
+)
+
+// pollForUpdates schedules the next background refresh after a jittered
+// interval, tagged with the schedule generation gen.
+func pollForUpdates(d time.Duration, jitterPercent, gen int) tea.Cmd {
+	return tea.Tick(jitteredInterval(d, jitterPercent), func(t time.Time) tea.Msg {
+		return fetchServersMsg{gen: gen}
 	})
 }
 
+// jitteredInterval spreads d randomly by up to ±percent so many clients
+// started at the same moment don't keep polling the API in lockstep.
+func jitteredInterval(d time.Duration, percent int) time.Duration {
+	if percent <= 0 {
+		return d
+	}
+	spread := float64(d) * float64(percent) / 100
+	return d + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// --- METRICS ---
+
+// fetchMetrics is what the dashboard has seen of the inventory, exposed to
+// Prometheus when metricsAddr is configured. Fetches run outside the
+// Bubble Tea loop, so access is guarded by a mutex.
+type fetchMetrics struct {
+	mu            sync.Mutex
+	statusCounts  map[string]int
+	lastDuration  time.Duration
+	fetches       int
+	fetchErrors   int
+	lastSuccessAt time.Time
+}
+
+var metrics = &fetchMetrics{statusCounts: map[string]int{}}
+
+// recordFetch updates the metrics after an inventory fetch. A nil
+// *fetchMetrics records nothing.
+func (fm *fetchMetrics) recordFetch(d time.Duration, servers []Server, err error) {
+	if fm == nil {
+		return
+	}
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.fetches++
+	fm.lastDuration = d
+	if err != nil {
+		fm.fetchErrors++
+		return
+	}
+	fm.lastSuccessAt = time.Now()
+	fm.statusCounts = map[string]int{}
+	for _, status := range statuses {
+		fm.statusCounts[status] = 0 // always report the known statuses
+	}
+	for _, server := range servers {
+		fm.statusCounts[server.Status]++
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (fm *fetchMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP wolfinv_servers Servers in the last fetched inventory by status.")
+	fmt.Fprintln(w, "# TYPE wolfinv_servers gauge")
+	names := make([]string, 0, len(fm.statusCounts))
+	for status := range fm.statusCounts {
+		names = append(names, status)
+	}
+	sort.Strings(names)
+	for _, status := range names {
+		fmt.Fprintf(w, "wolfinv_servers{status=%q} %d\n", status, fm.statusCounts[status])
+	}
+	fmt.Fprintln(w, "# HELP wolfinv_fetch_duration_seconds Duration of the last inventory fetch.")
+	fmt.Fprintln(w, "# TYPE wolfinv_fetch_duration_seconds gauge")
+	fmt.Fprintf(w, "wolfinv_fetch_duration_seconds %g\n", fm.lastDuration.Seconds())
+	fmt.Fprintln(w, "# HELP wolfinv_fetches_total Inventory fetches attempted.")
+	fmt.Fprintln(w, "# TYPE wolfinv_fetches_total counter")
+	fmt.Fprintf(w, "wolfinv_fetches_total %d\n", fm.fetches)
+	fmt.Fprintln(w, "# HELP wolfinv_fetch_errors_total Inventory fetches that failed.")
+	fmt.Fprintln(w, "# TYPE wolfinv_fetch_errors_total counter")
+	fmt.Fprintf(w, "wolfinv_fetch_errors_total %d\n", fm.fetchErrors)
+	if !fm.lastSuccessAt.IsZero() {
+		fmt.Fprintln(w, "# HELP wolfinv_last_success_timestamp_seconds Unix time of the last successful fetch.")
+		fmt.Fprintln(w, "# TYPE wolfinv_last_success_timestamp_seconds gauge")
+		fmt.Fprintf(w, "wolfinv_last_success_timestamp_seconds %d\n", fm.lastSuccessAt.Unix())
+	}
+}
+
+// startMetricsServer serves /metrics on addr in the background. The listener
+// is opened up front so a bad address fails at startup rather than silently.
+func startMetricsServer(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("metrics server: %v", err)
+		}
+	}()
+	return server, nil
+}
+
+// --- CRASH RECOVERY ---
+
+// panicMsg carries a panic out of a command's goroutine back to the event
+// loop, so it unwinds through main like a panic in Update or View would.
+type panicMsg struct {
+	value any
+	stack []byte
+}
+
+// crashGuard wraps the model so that command panics reach runGuarded.
+type crashGuard struct{ tea.Model }
+
+func (g crashGuard) Init() tea.Cmd {
+	return guardCmd(g.Model.Init())
+}
+
+func (g crashGuard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if crash, ok := msg.(panicMsg); ok {
+		panic(crash)
+	}
+	next, cmd := g.Model.Update(msg)
+	return crashGuard{next}, guardCmd(cmd)
+}
+
+// guardCmd turns a panic in cmd, or in any command it batches, into a panicMsg.
+func guardCmd(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() (msg tea.Msg) {
+		defer func() {
+			if r := recover(); r != nil {
+				msg = panicMsg{value: r, stack: debug.Stack()}
+			}
+		}()
+		msg = cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i := range batch {
+				batch[i] = guardCmd(batch[i])
+			}
+		}
+		return msg
+	}
+}
+
+// runGuarded runs p, and if anything panics, restores the terminal and writes
+// the stack trace to a crash log instead of dumping it over the screen.
+func runGuarded(p *tea.Program) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		_ = p.ReleaseTerminal()
+		value, stack := r, debug.Stack()
+		if crash, ok := r.(panicMsg); ok {
+			value, stack = crash.value, crash.stack
+		}
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("wolf-inv-crash-%s.log", time.Now().Format("20060102-150405")))
+		report := fmt.Sprintf("wolf-inv %s crashed at %s: %v\n\n%s", versionString(), time.Now().Format(time.RFC3339), value, stack)
+		if writeErr := os.WriteFile(path, []byte(report), 0o600); writeErr != nil {
+			err = fmt.Errorf("wolf-inv crashed: %v (could not write crash log: %v)", value, writeErr)
+			return
+		}
+		err = fmt.Errorf("wolf-inv crashed: %v (stack trace in %s)", value, path)
+	}()
+	_, err = p.Run()
+	return err
+}
+
 // --- MAIN ---
 
 var p *tea.Program
 
+// Build information, injected at build time via -ldflags "-X main.version=...".
+var version, commit, date string
+
+// versionString formats the build information, filling in placeholders for local builds.
+func versionString() string {
+	v, c, d := version, commit, date
+	if v == "" {
+		v = "dev"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s)", v, c, d)
+}
+
 func main() {
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	printConfig := flag.Bool("print-config", false, "print an example config.json with default values and exit")
+	listMode := flag.Bool("list", false, "print the inventory and exit instead of starting the dashboard")
+	listFormat := flag.String("format", "table", "output format for -list: "+strings.Join(listFormatNames(), ", "))
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("wolf-inv " + versionString())
+		return
+	}
+	if *printConfig {
+		// Field descriptions go to stderr so stdout can be redirected straight into a file.
+		if err := printExampleConfig(os.Stdout, os.Stderr); err != nil {
+			fmt.Printf("Error printing configuration: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// -format only means something with -list; check it before any loading.
+	if _, ok := listFormatters[*listFormat]; *listMode && !ok {
+		fmt.Fprintf(os.Stderr, "Unknown -format %q; expected one of %s\n", *listFormat, strings.Join(listFormatNames(), ", "))
+		os.Exit(2)
+	}
+
 	config, err := loadConfig()
 	if err != nil {
 		fmt.Printf("Error loading configuration: %v\n", err)
 		os.Exit(1)
 	}
 
-	items := []list.Item{statusItem("Online"), statusItem("Offline"), statusItem("Maintenance")}
+	// The TUI owns the terminal, so logs only go to a file when one is configured.
+	log.SetOutput(io.Discard)
+	if config.LogFile != "" {
+		logFile, err := os.OpenFile(config.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Printf("Error opening log file: %v\n", err)
+			os.Exit(1)
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+	}
 
-	// Initialize styles
-	messageStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("7")).Italic(true)
+	envName, env, err := config.activeEnv()
+	if err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
 
-	m := model{
-		apiBaseURL:      config.ApiBaseURL,
-		apiToken:        config.ApiToken, // Store the token in the model
-		loading:         true,
-		message:         "Initializing...",
-		state:           Viewing,
-		table:           table.New(),
-		textInput:       textinput.New(),
-		statusList:      list.New(items, itemDelegate{}, 0, 0),
-		spinnerStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("12")),
-		headerStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true).MarginBottom(1),
-		onlineStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("10")),
-		offlineStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("9")),
-		otherStyle:      lipgloss.NewStyle().Foreground(lipgloss.Color("11")),
-		tableStyle:      lipgloss.NewStyle().Border(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("6")).Padding(1),
-		messageStyle:    messageStyle,
-		successStyle:    messageStyle.Copy().Foreground(lipgloss.Color("10")), // Green
-		cancelStyle:     messageStyle.Copy().Foreground(lipgloss.Color("11")), // Yellow
-		helpStyle:       lipgloss.NewStyle().Padding(1, 2).Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("6")),
-		currentMsgStyle: messageStyle,
+	httpClient, err := newHTTPClient(config)
+	if err != nil {
+		fmt.Printf("Error setting up TLS: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *listMode {
+		result, err := newHTTPAPIClient(env.ApiBaseURL, env.ApiToken, httpClient, config).List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching inventory: %v\n", err)
+			os.Exit(1)
+		}
+		if result.Truncated > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: inventory truncated to %d servers; %d more not listed\n", config.MaxServers, result.Truncated)
+		}
+		if err := listFormatters[*listFormat](os.Stdout, result.Servers); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing inventory: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	m := newModel(config, httpClient, envName, env, func(msg tea.Msg) {
+		if p != nil {
+			p.Send(msg)
+		}
+	})
+	m.metrics = metrics
+
+	var metricsServer *http.Server
+	if config.MetricsAddr != "" {
+		metricsServer, err = startMetricsServer(config.MetricsAddr)
+		if err != nil {
+			fmt.Printf("Error starting metrics server: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	m.statusList.Title = "Select Server Status"
-	m.updateTable()
-	m.table.Focus()
 
-	p = tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	// Panics are recovered by runGuarded, which logs them to a file.
+	p = tea.NewProgram(crashGuard{m}, tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithoutCatchPanics())
+	err = runGuarded(p)
+	if metricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		metricsServer.Shutdown(ctx)
+		cancel()
+	}
+	if err != nil {
 		fmt.Printf("An error occurred: %v\n", err)
 		os.Exit(1)
 	}
 }
-
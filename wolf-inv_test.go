@@ -0,0 +1,1322 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// fakeAPI is an in-memory APIClient that records what was asked of it.
+type fakeAPI struct {
+	mu       sync.Mutex
+	servers  []Server
+	listErr  error
+	lists    int
+	upserts  []Server
+	creates  []Server
+	deletes  []string
+	statuses map[string]string
+}
+
+func (f *fakeAPI) List() (ListResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lists++
+	if f.listErr != nil {
+		return ListResult{}, f.listErr
+	}
+	return ListResult{Servers: append([]Server(nil), f.servers...)}, nil
+}
+
+func (f *fakeAPI) Get(name string) (Server, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, server := range f.servers {
+		if server.Name == name {
+			return server, nil
+		}
+	}
+	return Server{}, errNotFound
+}
+
+func (f *fakeAPI) Create(server Server) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.creates = append(f.creates, server)
+	return nil
+}
+
+func (f *fakeAPI) Upsert(server Server) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upserts = append(f.upserts, server)
+	return nil
+}
+
+func (f *fakeAPI) Delete(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deletes = append(f.deletes, name)
+	return nil
+}
+
+func (f *fakeAPI) SetStatus(name, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.statuses == nil {
+		f.statuses = map[string]string{}
+	}
+	f.statuses[name] = status
+	return nil
+}
+
+func (f *fakeAPI) Summary() (map[string]int, error) {
+	return nil, errNotFound
+}
+
+// newTestModel builds a model on the default config that talks to api.
+func newTestModel(t *testing.T, api APIClient) model {
+	t.Helper()
+	config := defaultConfig()
+	m := newModel(&config, http.DefaultClient, "", EnvConfig{}, nil)
+	m.api = api
+	m.loading = false
+	return m
+}
+
+// update runs msg through the model the way the program would.
+func update(t *testing.T, m model, msg tea.Msg) (model, tea.Cmd) {
+	t.Helper()
+	next, cmd := m.Update(msg)
+	return next.(model), cmd
+}
+
+// runCmd executes cmd and the commands it batches, returning the messages
+// that arrive promptly. Timers such as the poll schedule are left behind.
+func runCmd(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	done := make(chan tea.Msg, 1)
+	go func() { done <- cmd() }()
+	select {
+	case msg := <-done:
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			var msgs []tea.Msg
+			for _, cmd := range batch {
+				msgs = append(msgs, runCmd(cmd)...)
+			}
+			return msgs
+		}
+		if msg == nil {
+			return nil
+		}
+		return []tea.Msg{msg}
+	case <-time.After(200 * time.Millisecond):
+		return nil
+	}
+}
+
+// key builds a key press for a single character or a named key like "enter".
+func key(s string) tea.KeyMsg {
+	switch s {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestFetchServersThroughClient(t *testing.T) {
+	api := &fakeAPI{servers: []Server{{Name: "web1", Status: "Online"}, {Name: "db1", Status: "Offline"}}}
+	metrics := &fetchMetrics{statusCounts: map[string]int{}}
+
+	msg, ok := fetchServers(api, metrics)().(serverMsg)
+	if !ok {
+		t.Fatalf("fetchServers returned %T, want serverMsg", msg)
+	}
+	if !reflect.DeepEqual(msg.servers, api.servers) {
+		t.Errorf("servers = %v, want %v", msg.servers, api.servers)
+	}
+	if metrics.fetches != 1 || metrics.statusCounts["Offline"] != 1 {
+		t.Errorf("metrics not recorded: %d fetches, %v", metrics.fetches, metrics.statusCounts)
+	}
+
+	api.listErr = errors.New("boom")
+	failed, ok := fetchServers(api, nil)().(errMsg)
+	if !ok || !failed.fetch {
+		t.Fatalf("fetchServers on error = %#v, want a fetch errMsg", failed)
+	}
+}
+
+func TestModelLoadsFromFakeClient(t *testing.T) {
+	api := &fakeAPI{servers: []Server{{Name: "web1", Status: "Online"}, {Name: "db1", Status: "Offline"}}}
+	m := newTestModel(t, api)
+
+	for _, msg := range runCmd(fetchServers(m.api, m.metrics)) {
+		m, _ = update(t, m, msg)
+	}
+	if len(m.visible) != 2 {
+		t.Fatalf("visible = %d servers, want 2", len(m.visible))
+	}
+	if api.lists != 1 {
+		t.Errorf("List called %d times, want 1", api.lists)
+	}
+}
+
+func TestLongNamesAreTruncated(t *testing.T) {
+	long := strings.Repeat("a", 35) + "-host" // 40 characters
+	m := newTestModel(t, &fakeAPI{})
+	m.servers = []Server{{Name: long, IP: "10.0.0.1", Status: "Online"}, {Name: "web1", IP: "10.0.0.2", Status: "Offline"}}
+	m.updateTable()
+
+	width := m.widths()[0]
+	cell := m.table.Rows()[0][0]
+	if ansi.StringWidth(cell) != width || !strings.HasSuffix(cell, "…") {
+		t.Errorf("name cell = %q, want %d columns ending in …", cell, width)
+	}
+	if got := m.detailFields(m.visible[0])[0].value; got != long {
+		t.Errorf("detail name = %q, want the full name", got)
+	}
+
+	// Every row lines up with the header however long its name is.
+	lines := strings.Split(ansi.Strip(m.tableView()), "\n")
+	headerWidth := ansi.StringWidth(lines[0])
+	for _, line := range lines[tableHeaderLines : tableHeaderLines+2] {
+		if ansi.StringWidth(line) != headerWidth {
+			t.Errorf("row %q is %d columns wide, header is %d", line, ansi.StringWidth(line), headerWidth)
+		}
+	}
+	if !strings.Contains(lines[tableHeaderLines+1], "Offline") || !strings.Contains(lines[tableHeaderLines], "Online") {
+		t.Errorf("statuses not in their rows:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	servers := []Server{
+		{Name: "web1", IP: "10.0.0.1", Location: "eu-west", Status: "Offline"},
+		{Name: "web2", IP: "10.0.0.2", Location: "us-east", Status: "Offline"},
+		{Name: "db1", IP: "fe80::1", Location: "eu-north", Status: "Online"},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"web1", "web2", "db1"}},
+		{"WEB", []string{"web1", "web2"}},
+		{"status:offline AND loc:eu-*", []string{"web1"}},
+		{"status:offline AND loc:eu-* OR name:db", []string{"web1", "db1"}},
+		{"name:web?", []string{"web1", "web2"}},
+		{"location:*north", []string{"db1"}},
+		{"fe80::1", []string{"db1"}},
+	}
+	for _, tt := range tests {
+		expr, err := parseFilter(tt.query)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, server := range servers {
+			if expr.matches(server) {
+				got = append(got, server.Name)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"AND web", "web OR", "web AND OR db"} {
+		if _, err := parseFilter(query); err == nil {
+			t.Errorf("parseFilter(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestDiffInventories(t *testing.T) {
+	old := []Server{
+		{Name: "web1", Location: "Rack  4", Status: "Online"},
+		{Name: "web2", Location: "eu", Status: "Online"},
+		{Name: "gone", Status: "Online"},
+	}
+	updated := []Server{
+		{Name: "web1", Location: "Rack  5", Status: "Online"},
+		{Name: "web2", Location: "eu", Status: "Status: Offline"},
+		{Name: "new", Status: "Online"},
+	}
+	entry := diffInventories(old, updated)
+
+	if !reflect.DeepEqual(entry.Added, []string{"new"}) || !reflect.DeepEqual(entry.Removed, []string{"gone"}) {
+		t.Errorf("added %v, removed %v", entry.Added, entry.Removed)
+	}
+	want := []historyChange{
+		{Name: "web1", Changes: []string{"Location: Rack  4 → Rack  5"}},
+		{Name: "web2", Changes: []string{"Status: Online → Status: Offline"}, Status: true},
+	}
+	if !reflect.DeepEqual(entry.Changed, want) {
+		t.Errorf("changed = %#v, want %#v", entry.Changed, want)
+	}
+	if got := entry.summary(); got != "+1 added, -1 removed, 1 status change, 1 other change" {
+		t.Errorf("summary = %q", got)
+	}
+
+	// A location that merely contains "Status:" is not a status change.
+	entry = diffInventories(
+		[]Server{{Name: "web1", Location: "a"}},
+		[]Server{{Name: "web1", Location: "Status: b"}},
+	)
+	if got := entry.summary(); got != "1 other change" {
+		t.Errorf("summary = %q, want 1 other change", got)
+	}
+}
+
+func TestBulkDeleteAnnouncesOnce(t *testing.T) {
+	var mu sync.Mutex
+	var posts []string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		posts = append(posts, body.Text)
+		mu.Unlock()
+	}))
+	defer slack.Close()
+
+	api := &fakeAPI{servers: []Server{{Name: "web1"}, {Name: "web2"}}}
+	m := newTestModel(t, api)
+	m.config.SlackWebhookURL = slack.URL
+	m.envName = "staging"
+	m.bulkProgress = runBulkDelete(api, api.servers, 1)
+
+	cmd := waitForBulk(m.bulkProgress)
+	for cmd != nil {
+		msgs := runCmd(cmd)
+		cmd = nil
+		for _, msg := range msgs {
+			if _, ok := msg.(bulkProgressMsg); ok {
+				m, cmd = update(t, m, msg)
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(api.deletes) != 2 {
+		t.Fatalf("deleted %v, want both servers", api.deletes)
+	}
+	if len(posts) != 1 || !strings.Contains(posts[0], "deleted 2 servers: web1, web2 in staging") {
+		t.Errorf("slack posts = %q, want one naming both servers", posts)
+	}
+}
+
+func TestBulkDeleteOffersDecommission(t *testing.T) {
+	api := &fakeAPI{servers: []Server{{Name: "web1"}, {Name: "web2"}, {Name: "db1"}}}
+	m := newTestModel(t, api)
+	m.config.SoftDeleteSupported = true
+	m.config.BulkDeleteConfirmAt = 10
+	m.servers = api.servers
+	m.updateTable()
+	m.selected = map[string]bool{"web1": true, "web2": true}
+
+	m, _ = update(t, m, key("d"))
+	if m.state != DeleteChoice {
+		t.Fatalf("state = %v after d, want DeleteChoice", m.state)
+	}
+	m, _ = update(t, m, key("enter")) // Decommission is the first option
+	m, cmd := update(t, m, key("y"))
+	for cmd != nil {
+		msgs := runCmd(cmd)
+		cmd = nil
+		for _, msg := range msgs {
+			if _, ok := msg.(bulkProgressMsg); ok {
+				m, cmd = update(t, m, msg)
+			}
+		}
+	}
+
+	if len(api.deletes) != 0 {
+		t.Errorf("deleted %v, want none", api.deletes)
+	}
+	want := map[string]string{"web1": m.config.DecommissionStatus, "web2": m.config.DecommissionStatus}
+	if !reflect.DeepEqual(api.statuses, want) {
+		t.Errorf("statuses = %v, want %v", api.statuses, want)
+	}
+}
+
+func TestStatusFilterMatchingNothing(t *testing.T) {
+	m := newTestModel(t, &fakeAPI{})
+	m.state = Adding
+	m.addingState = InputStatus
+	m.statusList.SetFilterText("no such status")
+
+	m, _ = update(t, m, key("enter"))
+	if m.addingState != InputStatus || m.currentServer.Status != "" {
+		t.Errorf("enter with no match moved to %v with status %q", m.addingState, m.currentServer.Status)
+	}
+
+	m.state = BulkStatus
+	m, _ = update(t, m, key("enter"))
+	if m.state != BulkStatus || m.bulkStatus != "" {
+		t.Errorf("bulk enter with no match moved to %v with status %q", m.state, m.bulkStatus)
+	}
+}
+
+func TestSetConfigValue(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(yamlPath, []byte("# my inventory\napiBaseURL: http://x\npollIntervalSeconds: 30\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.yaml")
+	if err := os.Symlink(yamlPath, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := setConfigValue(link, "pollIntervalSeconds", 60); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(yamlPath)
+	if !strings.Contains(string(data), "# my inventory") || !strings.Contains(string(data), "pollIntervalSeconds: 60") {
+		t.Errorf("yaml after set:\n%s", data)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the symlink was replaced")
+	}
+	if info, _ := os.Stat(yamlPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	jsonPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"apiBaseURL": "http://x"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setConfigValue(jsonPath, "pinned", []string{"web1"}); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	data, _ = os.ReadFile(jsonPath)
+	if err := json.Unmarshal(data, &got); err != nil || got["apiBaseURL"] != "http://x" || !reflect.DeepEqual(got["pinned"], []any{"web1"}) {
+		t.Errorf("json after set: %s (%v)", data, err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestSwitchingEnvAppliesTheme(t *testing.T) {
+	config := defaultConfig()
+	config.Environments = map[string]EnvConfig{
+		"prod":    {ApiBaseURL: "http://prod", Theme: "9"},
+		"staging": {ApiBaseURL: "http://staging"},
+	}
+	m := newModel(&config, http.DefaultClient, "staging", config.Environments["staging"], nil)
+	if got := m.headerStyle.GetForeground(); got != lipgloss.Color("3") {
+		t.Fatalf("staging title color = %v, want the default", got)
+	}
+
+	m.state = SwitchingEnv
+	m.envList.Select(0) // prod
+	m, _ = update(t, m, key("enter"))
+	if m.envName != "prod" || m.headerStyle.GetForeground() != lipgloss.Color("9") || m.tableStyle.GetBorderTopForeground() != lipgloss.Color("9") {
+		t.Errorf("after switching to %s: title %v, border %v", m.envName, m.headerStyle.GetForeground(), m.tableStyle.GetBorderTopForeground())
+	}
+}
+
+func TestCursorAfterEmptyTable(t *testing.T) {
+	m := newTestModel(t, &fakeAPI{})
+	m.updateTable() // nothing loaded yet
+	m.servers = []Server{{Name: "web1"}, {Name: "web2"}}
+	m.updateTable()
+	if server, ok := m.selectedServer(); !ok || server.Name != "web1" {
+		t.Errorf("selected %q, %v after loading; want web1", server.Name, ok)
+	}
+}
+
+func TestTouchWaitsForChangeInFlight(t *testing.T) {
+	api := &fakeAPI{servers: []Server{{Name: "web1", Status: "Online"}}}
+	m := newTestModel(t, api)
+	m.servers = api.servers
+	m.updateTable()
+
+	m, _ = update(t, m, key("H"))
+	m, cmd := update(t, m, key("y"))
+	m, _ = update(t, m, key("H"))
+	if m.state == Touching {
+		t.Fatal("a second touch was offered while the first is in flight")
+	}
+	m, _ = update(t, m, key("d"))
+	if m.state == Deleting || m.state == DeleteChoice {
+		t.Fatal("a delete was offered while a touch is in flight")
+	}
+
+	for _, msg := range runCmd(cmd) {
+		m, _ = update(t, m, msg)
+	}
+	if len(api.upserts) != 1 {
+		t.Errorf("upserts = %d, want 1", len(api.upserts))
+	}
+	m, _ = update(t, m, key("H"))
+	if m.state != Touching {
+		t.Errorf("touch not offered once the first finished (state %v)", m.state)
+	}
+}
+
+func TestDecodeServersTruncates(t *testing.T) {
+	body := `[{"name":"a"},{"name":"b"},{"name":"c"},{"name":"d"},{"name":"e"}]`
+	tests := []struct {
+		name     string
+		body     string
+		envelope string
+		max      int
+		want     []string
+		dropped  int
+	}{
+		{"under the cap", body, "", 10, []string{"a", "b", "c", "d", "e"}, 0},
+		{"at the cap", body, "", 5, []string{"a", "b", "c", "d", "e"}, 0},
+		{"over the cap", body, "", 2, []string{"a", "b"}, 3},
+		{"no cap", body, "", 0, []string{"a", "b", "c", "d", "e"}, 0},
+		{"enveloped", `{"total":5,"servers":` + body + `,"next":null}`, "servers", 3, []string{"a", "b", "c"}, 2},
+	}
+	for _, tt := range tests {
+		result, err := decodeServers(strings.NewReader(tt.body), tt.envelope, tt.max)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, server := range result.Servers {
+			names = append(names, server.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) || result.Truncated != tt.dropped {
+			t.Errorf("%s: got %v with %d truncated, want %v with %d", tt.name, names, result.Truncated, tt.want, tt.dropped)
+		}
+	}
+
+	// Records past the cap are never decoded, so a bad one there isn't skipped.
+	result, err := decodeServers(strings.NewReader(`[{"name":"a"},{"name":7}]`), "", 1)
+	if err != nil || result.Skipped != 0 || result.Truncated != 1 {
+		t.Errorf("bad record past the cap: %+v, %v", result, err)
+	}
+	if _, err := decodeServers(strings.NewReader(`[{"name":"a"}`), "", 1); err == nil {
+		t.Error("an unterminated array decoded without error")
+	}
+}
+
+func TestRapidDoubleSubmit(t *testing.T) {
+	api := &fakeAPI{servers: []Server{{Name: "web1", IP: "10.0.0.1", Status: "Online"}}}
+	m := newTestModel(t, api)
+	m.servers = append([]Server(nil), api.servers...)
+	m.updateTable()
+
+	// Two confirms of the same edit before the first has been answered.
+	edited := Server{Name: "web1", IP: "10.0.0.9", Status: "Online"}
+	var cmds []tea.Cmd
+	for range 2 {
+		m.state, m.addingState = Editing, Confirm
+		m.originalServer, m.currentServer = editableFields(api.servers[0]), edited
+		var cmd tea.Cmd
+		m, cmd = update(t, m, key("y"))
+		cmds = append(cmds, cmd)
+	}
+	// And two delete confirms.
+	for range 2 {
+		m.state, m.deleteTarget, m.deleteBatch = Deleting, "web1", nil
+		var cmd tea.Cmd
+		m, cmd = update(t, m, key("y"))
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		runCmd(cmd)
+	}
+
+	if len(api.upserts) != 1 {
+		t.Errorf("upserts = %d, want 1", len(api.upserts))
+	}
+	if len(api.deletes) != 0 {
+		t.Errorf("deletes = %v while the edit was in flight, want none", api.deletes)
+	}
+
+	// Once the edit is answered, a double delete only deletes once.
+	m, _ = update(t, m, savedMsg{server: edited})
+	cmds = nil
+	for range 2 {
+		m.state, m.deleteTarget, m.deleteBatch = Deleting, "web1", nil
+		var cmd tea.Cmd
+		m, cmd = update(t, m, key("y"))
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		runCmd(cmd)
+	}
+	if !reflect.DeepEqual(api.deletes, []string{"web1"}) {
+		t.Errorf("deletes = %v, want web1 once", api.deletes)
+	}
+}
+
+// newTestClient starts an httptest server with handler and returns a client
+// for it built from the default config, adjusted by configure if given.
+func newTestClient(t *testing.T, handler http.HandlerFunc, configure func(*Config)) *httpAPIClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := defaultConfig()
+	if configure != nil {
+		configure(&config)
+	}
+	return newHTTPAPIClient(server.URL, "secret", server.Client(), &config)
+}
+
+func TestDeleteEscapesName(t *testing.T) {
+	tests := []struct {
+		name, base, want string
+	}{
+		{"web1", "", "/delete/web1"},
+		{"db server 1", "", "/delete/db%20server%201"},
+		{"a/b", "", "/delete/a%2Fb"},
+		{"50%", "", "/delete/50%25"},
+		{"a/b", "/", "/delete/a%2Fb"}, // a trailing slash on apiBaseURL
+	}
+	for _, tt := range tests {
+		var got string
+		api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			got = r.Method + " " + r.URL.EscapedPath()
+		}, nil)
+		api.baseURL += tt.base
+		if err := api.Delete(tt.name); err != nil {
+			t.Errorf("Delete(%q): %v", tt.name, err)
+			continue
+		}
+		if got != "DELETE "+tt.want {
+			t.Errorf("Delete(%q) requested %q, want DELETE %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigYAMLMatchesJSON(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "config.json")
+	yamlPath := filepath.Join(dir, "config.yml")
+	os.WriteFile(jsonPath, []byte(`{
+  "apiBaseURL": "https://inv.example.com",
+  "apiToken": "t0ken",
+  "pollIntervalSeconds": 45,
+  "pinned": ["web1", "db1"],
+  "environments": {"prod": {"apiBaseURL": "https://prod", "theme": "9"}}
+}`), 0o644)
+	os.WriteFile(yamlPath, []byte(`# the same settings as config.json
+apiBaseURL: https://inv.example.com
+apiToken: t0ken
+pollIntervalSeconds: 45
+pinned: [web1, db1]
+environments:
+  prod:
+    apiBaseURL: https://prod
+    theme: "9"
+`), 0o644)
+
+	fromJSON, err := loadConfigFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromYAML, err := loadConfigFile(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON.path, fromYAML.path = "", ""
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Errorf("YAML config differs from JSON:\n json %+v\n yaml %+v", fromJSON, fromYAML)
+	}
+	if fromYAML.PollIntervalSeconds != 45 || fromYAML.MaxServers != defaultConfig().MaxServers {
+		t.Errorf("yaml config lost its values or defaults: %+v", fromYAML)
+	}
+}
+
+func TestLoadConfigFallsBackToYAML(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".config", "wolf-inv")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("apiBaseURL: https://from-yaml\n"), 0o644)
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ApiBaseURL != "https://from-yaml" {
+		t.Errorf("apiBaseURL = %q, want the YAML file's", config.ApiBaseURL)
+	}
+
+	// config.json stays the primary default when both exist.
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"apiBaseURL": "https://from-json"}`), 0o644)
+	if config, err = loadConfig(); err != nil || config.ApiBaseURL != "https://from-json" {
+		t.Errorf("with config.json present got %+v, %v", config, err)
+	}
+}
+
+func TestListResponseShapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope string
+		body     string
+		want     []string
+		err      string
+	}{
+		{"bare array", "", `[{"name":"web1"},{"name":"db1"}]`, []string{"web1", "db1"}, ""},
+		{"envelope", "servers", `{"servers":[{"name":"web1"},{"name":"db1"}],"total":42}`, []string{"web1", "db1"}, ""},
+		{"envelope field null", "servers", `{"servers":null,"total":0}`, nil, ""},
+		{"missing envelope field", "servers", `{"items":[{"name":"web1"}],"total":1}`, nil, `no "servers" field`},
+		{"envelope field not a list", "servers", `{"servers":{"name":"web1"}}`, nil, `failed to decode "servers" field`},
+		{"envelope expected, array sent", "servers", `[{"name":"web1"}]`, nil, "expected an object"},
+		{"array expected, envelope sent", "", `{"servers":[]}`, nil, "expected an array"},
+	}
+	for _, tt := range tests {
+		api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(tt.body))
+		}, func(c *Config) { c.ResponseEnvelopeField = tt.envelope })
+
+		result, err := api.List()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, server := range result.Servers {
+			names = append(names, server.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, names, tt.want)
+		}
+	}
+}
+
+// failingTransport fails the first failures requests without a response,
+// like a dropped connection, and sends the rest to next.
+type failingTransport struct {
+	failures int
+	next     http.RoundTripper
+}
+
+func (f *failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("connection reset by peer")
+	}
+	return f.next.RoundTrip(r)
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name           string
+		retryMutations bool
+		dropped        int // connections dropped before any response
+		status         int // the status of every response after that
+		mutation       bool
+		wantRequests   int
+		wantErr        bool
+	}{
+		{"read retries a 5xx", false, 0, 503, false, 3, true},
+		{"read retries a dropped connection", false, 1, 200, false, 1, false},
+		{"mutation does not retry a 5xx", true, 0, 503, true, 1, true},
+		{"mutation does not retry by default", false, 1, 200, true, 0, true},
+		{"mutation retries a dropped connection when allowed", true, 1, 200, true, 1, false},
+	}
+	for _, tt := range tests {
+		requests := 0
+		api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tt.status)
+			w.Write([]byte("[]"))
+		}, func(c *Config) {
+			c.MaxRetries = 2
+			c.RetryMutations = tt.retryMutations
+		})
+		api.client = &http.Client{Transport: &failingTransport{failures: tt.dropped, next: api.client.Transport}}
+		var waits []time.Duration
+		api.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+		var err error
+		if tt.mutation {
+			err = api.Upsert(Server{Name: "web1"})
+		} else {
+			_, err = api.List()
+		}
+		if (err != nil) != tt.wantErr || requests != tt.wantRequests {
+			t.Errorf("%s: %d requests reached the API with error %v; want %d, error %v", tt.name, requests, err, tt.wantRequests, tt.wantErr)
+		}
+		for i, wait := range waits {
+			if want := retryBackoff << i; wait != want {
+				t.Errorf("%s: retry %d waited %v, want %v", tt.name, i+1, wait, want)
+			}
+		}
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"7", 7 * time.Second},
+		{" 0 ", 0},
+		{"3600", maxRetryAfter},
+		{"-5", time.Second}, // invalid, so the fallback
+		{"", time.Second},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header, now, time.Second); got != tt.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+
+	// A rate-limited read waits as long as it is told to, then succeeds.
+	requests := 0
+	api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("[]"))
+	}, nil)
+	var waits []time.Duration
+	api.sleep = func(d time.Duration) { waits = append(waits, d) }
+	if _, err := api.List(); err != nil || !reflect.DeepEqual(waits, []time.Duration{7 * time.Second}) {
+		t.Errorf("read after 429: waited %v, error %v; want one 7s wait", waits, err)
+	}
+
+	// A rate-limited mutation is reported instead of replayed.
+	requests = 0
+	err := api.Delete("web1")
+	if err == nil || err.Error() != "rate limited by API, retry in 7s" || requests != 1 {
+		t.Errorf("delete after 429: %v after %d requests", err, requests)
+	}
+}
+
+func TestLoadConfigRejectsUnknownFields(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		file, content, want string
+	}{
+		{"config.json", `{"apiBaseURL": "https://x", "apiTokn": "t0ken"}`, `unknown field "apiTokn" in config.json`},
+		// encoding/json alone would accept a name that only differs in case.
+		{"config.json", `{"apiBaseURL": "https://x", "apitoken": "t0ken"}`, `unknown field "apitoken" (did you mean "apiToken"?) in config.json`},
+		{"config.json", `{"environments": {"prod": {"apibaseurl": "https://x"}}}`, `unknown field "apibaseurl" (did you mean "apiBaseURL"?)`},
+		{"config.yaml", "apiBaseURL: https://x\napitoken: t0ken\n", "line 2: field apitoken not found"},
+		{"config.yaml", "environments:\n  prod:\n    apiBaseUrl: https://x\n", "line 3: field apiBaseUrl not found"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		os.WriteFile(path, []byte(tt.content), 0o644)
+		_, err := loadConfigFile(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one containing %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestRefreshKeepsFilter(t *testing.T) {
+	servers := []Server{{Name: "web1"}, {Name: "web2"}, {Name: "db1"}}
+	m := newTestModel(t, &fakeAPI{})
+	m, _ = update(t, m, serverMsg{servers: servers, api: m.api})
+	for _, k := range []string{"/", "w", "e", "b"} {
+		m, _ = update(t, m, key(k))
+	}
+	if len(m.table.Rows()) != 2 {
+		t.Fatalf("filtered rows = %d, want 2", len(m.table.Rows()))
+	}
+
+	// A refresh lands while the query is still being typed.
+	m, _ = update(t, m, serverMsg{servers: servers, api: m.api})
+	if len(m.table.Rows()) != 2 {
+		t.Errorf("filtered rows after refresh = %d, want 2", len(m.table.Rows()))
+	}
+	if !m.filtering || !m.filterInput.Focused() || m.filterInput.Value() != "web" {
+		t.Errorf("filter input after refresh: filtering %v, focused %v, value %q", m.filtering, m.filterInput.Focused(), m.filterInput.Value())
+	}
+	m, _ = update(t, m, key("1"))
+	if m.filterQuery != "web1" || len(m.table.Rows()) != 1 {
+		t.Errorf("typing after refresh: query %q, %d rows", m.filterQuery, len(m.table.Rows()))
+	}
+}
+
+// writeSelfSigned creates a self-signed client certificate and its key in
+// dir, returning their paths and the parsed certificate.
+func writeSelfSigned(t *testing.T, dir, name string) (certPath, keyPath string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, _ = x509.ParseCertificate(der)
+	return certPath, keyPath, cert
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, clientCert := writeSelfSigned(t, dir, "client")
+	_, otherKey, _ := writeSelfSigned(t, dir, "other")
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}]`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caPath := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644)
+
+	list := func(config Config) (ListResult, error) {
+		client, err := newHTTPClient(&config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newHTTPAPIClient(server.URL, "", client, &config).List()
+	}
+	config := defaultConfig()
+	config.MaxRetries = 0 // a refused handshake fails at once
+	config.CABundlePath, config.ClientCertPath, config.ClientKeyPath = caPath, certPath, keyPath
+	result, err := list(config)
+	if err != nil || len(result.Servers) != 1 || result.Servers[0].Name != "client" {
+		t.Fatalf("with the client certificate: %+v, %v", result.Servers, err)
+	}
+	config.ClientCertPath, config.ClientKeyPath = "", ""
+	if _, err := list(config); err == nil {
+		t.Error("the server accepted a request without a client certificate")
+	}
+
+	for _, tt := range []struct {
+		name               string
+		ca, cert, key, err string
+	}{
+		{"key mismatch", "", certPath, otherKey, "could not load client certificate"},
+		{"missing key file", "", certPath, filepath.Join(dir, "missing.key"), "could not load client certificate"},
+		{"cert without key", "", certPath, "", "must be set together"},
+		{"key without cert", "", "", keyPath, "must be set together"},
+		{"missing CA bundle", filepath.Join(dir, "missing.pem"), "", "", "could not read CA bundle"},
+		{"CA bundle without certificates", keyPath, "", "", "no certificates found"},
+	} {
+		config := defaultConfig()
+		config.CABundlePath, config.ClientCertPath, config.ClientKeyPath = tt.ca, tt.cert, tt.key
+		if _, err := newHTTPClient(&config); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoadConfigUnreadablePath(t *testing.T) {
+	t.Run("directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.Mkdir(path, 0o755)
+		_, err := loadConfigFile(path)
+		if err == nil || err.Error() != "config path "+path+" is a directory, not a file" {
+			t.Errorf("error = %v", err)
+		}
+	})
+	// Permission errors are injected, since root can open anything.
+	t.Run("permission denied", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte("{}"), 0o600)
+		defer func(open func(string) (*os.File, error)) { openConfig = open }(openConfig)
+		openConfig = func(name string) (*os.File, error) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+		}
+		_, err := loadConfigFile(path)
+		if err == nil || err.Error() != "permission denied reading "+path {
+			t.Errorf("error = %v", err)
+		}
+	})
+	t.Run("unsearchable directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "locked", "config.json")
+		defer func(stat func(string) (fs.FileInfo, error)) { statConfig = stat }(statConfig)
+		statConfig = func(name string) (fs.FileInfo, error) {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrPermission}
+		}
+		_, err := loadConfigFile(path)
+		if err == nil || err.Error() != "permission denied reading "+path {
+			t.Errorf("error = %v", err)
+		}
+	})
+	t.Run("parent is a file", func(t *testing.T) {
+		parent := filepath.Join(t.TempDir(), "wolf-inv")
+		os.WriteFile(parent, nil, 0o600)
+		path := filepath.Join(parent, "config.json")
+		_, err := loadConfigFile(path)
+		if !errors.Is(err, syscall.ENOTDIR) || !strings.Contains(err.Error(), path) {
+			t.Errorf("error = %v", err)
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		_, err := loadConfigFile(path)
+		if err == nil || !strings.Contains(err.Error(), "Please create one at '"+path+"'") {
+			t.Errorf("error = %v", err)
+		}
+	})
+}
+
+func TestTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	var auth []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		w.Write([]byte("[]"))
+	}
+	api := newTestClient(t, handler, func(c *Config) { c.TokenFile = tokenPath })
+
+	// The file wins over the static token and is re-read for every request.
+	os.WriteFile(tokenPath, []byte("first\n"), 0o600)
+	if _, err := api.List(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(tokenPath, []byte("second"), 0o600)
+	if _, err := api.List(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Bearer first", "Bearer second"}; !reflect.DeepEqual(auth, want) {
+		t.Errorf("Authorization = %q, want %q", auth, want)
+	}
+
+	// Without a token file the static token is sent.
+	auth = nil
+	if _, err := newTestClient(t, handler, nil).List(); err != nil || !reflect.DeepEqual(auth, []string{"Bearer secret"}) {
+		t.Errorf("static token: Authorization = %q, error %v", auth, err)
+	}
+
+	// A missing, empty or unreadable file fails before anything is sent.
+	auth = nil
+	os.WriteFile(tokenPath, []byte(" \n"), 0o600)
+	if _, err := api.List(); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("empty token file: %v", err)
+	}
+	os.Remove(tokenPath)
+	if err := api.Delete("web1"); err == nil || !strings.Contains(err.Error(), "could not read token file") {
+		t.Errorf("missing token file: %v", err)
+	}
+	os.Mkdir(tokenPath, 0o700)
+	if _, err := api.List(); err == nil || !strings.Contains(err.Error(), "could not read token file") {
+		t.Errorf("unreadable token file: %v", err)
+	}
+	if len(auth) != 0 {
+		t.Errorf("requests were sent without a token: %q", auth)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	for _, tt := range []struct{ configured, want string }{
+		{"", defaultUserAgent()},
+		{"ops-dashboard/2.0", "ops-dashboard/2.0"},
+	} {
+		var got []string
+		api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			got = append(got, r.Header.Get("User-Agent"))
+			w.Write([]byte("[]"))
+		}, func(c *Config) { c.UserAgent = tt.configured })
+
+		api.List()
+		api.Upsert(Server{Name: "web1"})
+		api.Delete("web1")
+		if want := []string{tt.want, tt.want, tt.want}; !reflect.DeepEqual(got, want) {
+			t.Errorf("User-Agent = %q, want %q", got, want)
+		}
+	}
+	if !strings.HasPrefix(defaultUserAgent(), "wolf-inv/") {
+		t.Errorf("default User-Agent %q does not name the tool", defaultUserAgent())
+	}
+}
+
+func TestTagsDecoding(t *testing.T) {
+	tests := []struct {
+		json string
+		want tagList
+		err  bool
+	}{
+		{`{"name":"web1","tags":["prod","eu"]}`, tagList{"prod", "eu"}, false},
+		{`{"name":"web1","tags":"prod, eu"}`, tagList{"prod", "eu"}, false},
+		{`{"name":"web1","tags":"prod,,eu,"}`, tagList{"prod", "eu"}, false},
+		{`{"name":"web1","tags":[" prod ",""]}`, tagList{"prod"}, false},
+		{`{"name":"web1","tags":null}`, nil, false},
+		{`{"name":"web1","tags":""}`, nil, false},
+		{`{"name":"web1","tags":[]}`, nil, false},
+		{`{"name":"web1"}`, nil, false},
+		{`{"name":"web1","tags":[1,2]}`, nil, true},
+		{`{"name":"web1","tags":{"env":"prod"}}`, nil, true},
+	}
+	for _, tt := range tests {
+		var server Server
+		err := json.Unmarshal([]byte(tt.json), &server)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.json, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(server.Tags, tt.want) {
+			t.Errorf("%s: tags %#v, want %#v", tt.json, server.Tags, tt.want)
+		}
+	}
+
+	// Tags are written back as an array, and dropped when there are none.
+	data, _ := json.Marshal(Server{Name: "web1", Tags: tagList{"prod", "eu"}})
+	if !strings.Contains(string(data), `"tags":["prod","eu"]`) {
+		t.Errorf("encoded %s", data)
+	}
+	data, _ = json.Marshal(Server{Name: "web1"})
+	if strings.Contains(string(data), "tags") {
+		t.Errorf("encoded %s with empty tags", data)
+	}
+}
+
+func TestSwitchingEnvForgetsOldServers(t *testing.T) {
+	config := defaultConfig()
+	config.Environments = map[string]EnvConfig{"prod": {ApiBaseURL: "http://prod"}, "staging": {ApiBaseURL: "http://staging"}}
+	staging := &fakeAPI{servers: []Server{{Name: "web1", Status: "Online"}}}
+	m := newModel(&config, http.DefaultClient, "staging", config.Environments["staging"], nil)
+	m.api = staging
+	for _, msg := range runCmd(fetchServers(m.api, nil)) {
+		m, _ = update(t, m, msg)
+	}
+	m.selected["web1"] = true
+	m.marks["a"] = "web1"
+	m.compareBase = "web1"
+	m.lastAction, m.lastServer = Deleting, Server{Name: "web1"}
+
+	// A poll goes out to staging, and another result is held while the
+	// switcher is open.
+	inFlight := fetchServers(m.api, nil)
+	m.state = SwitchingEnv
+	m, _ = update(t, m, runCmd(fetchServers(m.api, nil))[0])
+	if len(m.deferred) != 1 {
+		t.Fatalf("deferred = %d messages, want the held fetch", len(m.deferred))
+	}
+	m.envList.Select(0) // prod
+	m, _ = update(t, m, key("enter"))
+	prod := &fakeAPI{servers: []Server{{Name: "web1", Status: "Offline"}}}
+	m.api = prod
+
+	if len(m.selected) != 0 || len(m.marks) != 0 || m.compareBase != "" || m.lastAction != Viewing || len(m.deferred) != 0 {
+		t.Errorf("staging state survived the switch: selected %v, marks %v, compare %q, last %v, deferred %d",
+			m.selected, m.marks, m.compareBase, m.lastAction, len(m.deferred))
+	}
+	for _, msg := range runCmd(inFlight) {
+		m, _ = update(t, m, msg)
+	}
+	if len(m.servers) != 0 {
+		t.Errorf("a staging fetch landed after the switch: %v", m.servers)
+	}
+
+	for _, msg := range runCmd(fetchServers(m.api, nil)) {
+		m, _ = update(t, m, msg)
+	}
+	m, _ = update(t, m, key("."))
+	if m.state != Viewing || len(prod.deletes) != 0 {
+		t.Errorf("'.' repeated a staging delete in prod (state %v)", m.state)
+	}
+	if len(m.servers) != 1 || m.servers[0].Status != "Offline" {
+		t.Errorf("prod servers = %v", m.servers)
+	}
+}
+
+func TestPingSweepSkipsInvalidIPs(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// With no IP the dial would go to this machine's port, which is listening.
+	servers := []Server{{Name: "up", IP: "127.0.0.1"}, {Name: "empty"}, {Name: "name", IP: "localhost"}}
+	results := map[string]error{}
+	for result := range startPingSweep(context.Background(), servers, port) {
+		results[result.name] = result.err
+	}
+	if results["up"] != nil {
+		t.Errorf("127.0.0.1: %v", results["up"])
+	}
+	for _, name := range []string{"empty", "name"} {
+		if !errors.Is(results[name], errNoValidIP) {
+			t.Errorf("%s: %v, want errNoValidIP", name, results[name])
+		}
+	}
+}
+
+func TestExtraConfirmKeyIsIgnored(t *testing.T) {
+	m := newTestModel(t, &fakeAPI{})
+	m.servers = []Server{{Name: "web1", Status: "Online"}}
+	m.updateTable()
+	m.state, m.addingState = Editing, Confirm
+	m.originalServer, m.currentServer = m.servers[0], Server{Name: "web1", Status: "Offline"}
+
+	m, _ = update(t, m, key("y"))
+	message := m.message
+	m, _ = update(t, m, key("y")) // the key is pressed once too often
+	if m.message != message {
+		t.Errorf("a second y replaced %q with %q", message, m.message)
+	}
+}
+
+func TestCurlCommandToken(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenPath, []byte("rotated\n"), 0o600)
+	m := newTestModel(t, &fakeAPI{})
+	m.apiToken = "static"
+	server := Server{Name: "web1"}
+
+	command, err := m.curlCommand(server)
+	if err != nil || !strings.Contains(command, `"$WOLF_INV_TOKEN"`) || strings.Contains(command, "static") {
+		t.Errorf("token hidden: %v\n%s", err, command)
+	}
+	m.config.CurlShowToken = true
+	if command, err = m.curlCommand(server); err != nil || !strings.Contains(command, "Bearer static") {
+		t.Errorf("static token: %v\n%s", err, command)
+	}
+	m.config.TokenFile = tokenPath
+	if command, err = m.curlCommand(server); err != nil || !strings.Contains(command, "Bearer rotated") {
+		t.Errorf("token file: %v\n%s", err, command)
+	}
+	os.Remove(tokenPath)
+	if _, err = m.curlCommand(server); err == nil {
+		t.Error("a missing token file built a command anyway")
+	}
+}
+
+func TestSaveAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.json")
+	notes := map[string]string{"web1": "disk replaced", "db1": "do not reboot"}
+	if msg := saveAnnotations(path, notes)(); msg != nil {
+		t.Fatalf("save: %v", msg)
+	}
+	if got := loadAnnotations(path); !reflect.DeepEqual(got, notes) {
+		t.Errorf("loaded %v, want %v", got, notes)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("notes file mode: %v, %v", info, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestListRejectsOversizedResponse(t *testing.T) {
+	// A valid array just over the cap, so only the limit can reject it.
+	entry := []byte(`{"name":"web1"},`)
+	api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+		for written := 1; written <= maxResponseBytes; written += len(entry) {
+			w.Write(entry)
+		}
+		w.Write([]byte(`{"name":"last"}]`))
+	}, nil)
+
+	result, err := api.List()
+	if err == nil || !strings.Contains(err.Error(), "larger than 64 MB") {
+		t.Fatalf("error %v, want one about the 64 MB limit", err)
+	}
+	if len(result.Servers) != 0 || result.Raw != nil {
+		t.Errorf("got %d servers and %d raw bytes, want nothing decoded", len(result.Servers), len(result.Raw))
+	}
+}
+
+func TestImportReportsProgress(t *testing.T) {
+	api := &fakeAPI{servers: []Server{{Name: "web1"}}}
+	m := newTestModel(t, api)
+	m.servers = api.servers
+	m, _ = update(t, m, importLoadedMsg{path: "servers.csv", servers: []Server{{Name: "web1"}, {Name: "web2"}, {Name: "web3"}}})
+	m.config.MaxConcurrency = 1
+
+	m, cmd := update(t, m, key("o"))
+	var progress []string
+	for cmd != nil {
+		msgs := runCmd(cmd)
+		cmd = nil
+		for _, msg := range msgs {
+			if _, ok := msg.(bulkProgressMsg); ok {
+				m, cmd = update(t, m, msg)
+				progress = append(progress, m.message)
+			}
+		}
+	}
+
+	want := []string{"Importing 1/3 servers...", "Importing 2/3 servers...", "Imported: 2 created, 1 overwritten, 0 skipped."}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("messages = %q, want %q", progress, want)
+	}
+	if len(api.creates) != 2 || len(api.upserts) != 1 || api.upserts[0].Name != "web1" {
+		t.Errorf("created %v and overwrote %v", api.creates, api.upserts)
+	}
+	if m.loading {
+		t.Error("still loading after the import finished")
+	}
+}
+
+func TestImportSkippingEverything(t *testing.T) {
+	api := &fakeAPI{servers: []Server{{Name: "web1"}}}
+	m := newTestModel(t, api)
+	m.servers = api.servers
+	m, _ = update(t, m, importLoadedMsg{path: "servers.csv", servers: []Server{{Name: "web1"}}})
+
+	m, _ = update(t, m, key("s"))
+	if m.message != "Imported: 0 created, 0 overwritten, 1 skipped." || m.loading {
+		t.Errorf("message = %q, loading = %v", m.message, m.loading)
+	}
+}